@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// auditResult describes how a live prefix list compares to its expected file.
+type auditResult struct {
+	Name   string   `json:"name"`
+	ID     string   `json:"id"`
+	File   string   `json:"file"`
+	InSync bool     `json:"inSync"`
+	Add    []string `json:"add,omitempty"`
+	Remove []string `json:"remove,omitempty"`
+
+	expected []prefixEntry
+}
+
+// auditPrefixLists compares every prefix list whose name starts with
+// namePrefix against <dir>/<name>.txt. Lists without an expected file are
+// skipped with a warning.
+func auditPrefixLists(svc *ec2.Client, namePrefix, dir string) ([]auditResult, error) {
+	prefixLists, err := describePrefixLists(svc, tagFilters(nil))
+	if err != nil {
+		return nil, err
+	}
+
+	var results []auditResult
+	for _, pl := range prefixLists {
+		name := aws.ToString(pl.PrefixListName)
+		if !strings.HasPrefix(name, namePrefix) {
+			continue
+		}
+
+		file, err := findExpectedFile(dir, name)
+		if err != nil {
+			return nil, err
+		}
+		if file == "" {
+			log.Printf("No expected file for prefix list %s in %s, skipping", name, dir)
+			continue
+		}
+
+		result, err := auditPrefixList(svc, pl, file)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// auditPrefixList compares a live prefix list against the entries of its
+// address family in file.
+func auditPrefixList(svc *ec2.Client, pl types.ManagedPrefixList, file string) (auditResult, error) {
+	ipv4s, ipv6s, err := readIPsFromFile(file)
+	if err != nil {
+		return auditResult{}, fmt.Errorf("failed to read IPs from %s: %w", file, err)
+	}
+	expected := ipv4s
+	if aws.ToString(pl.AddressFamily) == "IPv6" {
+		expected = ipv6s
+	}
+
+	current, err := listPrefixListEntries(svc, aws.ToString(pl.PrefixListId), 0)
+	if err != nil {
+		return auditResult{}, err
+	}
+	toAdd, toRemove := planChanges(current, expected)
+	return auditResult{
+		Name:   aws.ToString(pl.PrefixListName),
+		ID:     aws.ToString(pl.PrefixListId),
+		File:   file,
+		InSync: len(toAdd) == 0 && len(toRemove) == 0,
+		Add:    cidrsOf(toAdd),
+		Remove: toRemove,
+
+		expected: expected,
+	}, nil
+}
+
+// findExpectedFile returns the path of the expected file for a prefix list,
+// trying <name>.txt before <name>, or "" if neither exists.
+func findExpectedFile(dir, name string) (string, error) {
+	for _, candidate := range []string{name + ".txt", name} {
+		path := filepath.Join(dir, candidate)
+		_, err := os.Stat(path)
+		if err == nil {
+			return path, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+func countOutOfSync(results []auditResult) int {
+	n := 0
+	for _, r := range results {
+		if !r.InSync {
+			n++
+		}
+	}
+	return n
+}
+
+func printAuditResults(results []auditResult) {
+	if jsonOutput() {
+		if results == nil {
+			results = []auditResult{}
+		}
+		printJSON(results)
+		return
+	}
+	if opts.output == "table" {
+		w := newTableWriter()
+		fmt.Fprintln(w, "NAME\tID\tSTATUS\tCHANGE\tCIDR")
+		for _, r := range results {
+			if r.InSync {
+				fmt.Fprintf(w, "%s\t%s\tin sync\t\t\n", r.Name, r.ID)
+				continue
+			}
+			for _, cidr := range r.Add {
+				fmt.Fprintf(w, "%s\t%s\tout of sync\t+\t%s\n", r.Name, r.ID, cidr)
+			}
+			for _, cidr := range r.Remove {
+				fmt.Fprintf(w, "%s\t%s\tout of sync\t-\t%s\n", r.Name, r.ID, cidr)
+			}
+		}
+		w.Flush()
+		return
+	}
+	for _, r := range results {
+		if r.InSync {
+			fmt.Printf("%s (%s): in sync\n", r.Name, r.ID)
+			continue
+		}
+		fmt.Printf("%s (%s): out of sync with %s\n", r.Name, r.ID, r.File)
+		for _, cidr := range r.Add {
+			fmt.Println(colorize(ansiGreen, "  + "+cidr))
+		}
+		for _, cidr := range r.Remove {
+			fmt.Println(colorize(ansiRed, "  - "+cidr))
+		}
+	}
+}
+
+// reconcilePrefixLists audits the matching prefix lists and updates every one
+// that is out of sync. With dryRun the differences are only printed.
+func reconcilePrefixLists(svc *ec2.Client, namePrefix, dir string, dryRun bool) error {
+	results, err := auditPrefixLists(svc, namePrefix, dir)
+	if err != nil {
+		return err
+	}
+	printAuditResults(results)
+
+	outOfSync := countOutOfSync(results)
+	if dryRun {
+		log.Printf("Dry run: would update %d of %d prefix list(s)", outOfSync, len(results))
+		return nil
+	}
+
+	var errs []error
+	updated := 0
+	for _, r := range results {
+		if r.InSync {
+			continue
+		}
+		if err := updatePrefixListByID(svc, r.ID, r.expected); err != nil {
+			err = fmt.Errorf("failed to reconcile %s: %w", r.Name, err)
+			if opts.failFast {
+				return err
+			}
+			log.Print(err)
+			errs = append(errs, err)
+			continue
+		}
+		updated++
+	}
+	log.Printf("Updated %d of %d out-of-sync prefix list(s)", updated, outOfSync)
+	return errors.Join(errs...)
+}
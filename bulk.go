@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"gopkg.in/yaml.v3"
+)
+
+// bulkItem is one prefix list specification in a -bulk-file.
+type bulkItem struct {
+	Name   string            `yaml:"name"`
+	File   string            `yaml:"file"`
+	Action string            `yaml:"action"`
+	Tags   map[string]string `yaml:"tags"`
+}
+
+// loadBulkFile reads the items of a YAML or JSON bulk file. Items default to
+// the create action, and relative IP file paths are resolved against the
+// bulk file's directory; URLs, s3:// URIs and ssm:// parameters are kept.
+func loadBulkFile(path string) ([]bulkItem, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// JSON is valid YAML, so one decoder reads both.
+	var items []bulkItem
+	if err := yaml.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	for i := range items {
+		item := &items[i]
+		if item.Name == "" || item.File == "" {
+			return nil, fmt.Errorf("%s: item %d needs a name and a file", path, i+1)
+		}
+		if item.Action == "" {
+			item.Action = "create"
+		}
+		if item.Action != "create" && item.Action != "update" {
+			return nil, fmt.Errorf("%s: item %d (%s) has unsupported action %q", path, i+1, item.Name, item.Action)
+		}
+		if !isRemoteSource(item.File) && !filepath.IsAbs(item.File) {
+			item.File = filepath.Join(filepath.Dir(path), item.File)
+		}
+	}
+	return items, nil
+}
+
+// runBulk creates or updates the prefix lists of every bulk item, with the
+// item's tags merged over tags. Lists an item updates are tagged too. A
+// failed item does not stop the others; the failures are reported together
+// at the end.
+func runBulk(svc *ec2.Client, items []bulkItem, tags []types.Tag) error {
+	var errs []error
+	for _, item := range items {
+		log.Printf("Processing %s (%s) from %s", item.Name, item.Action, item.File)
+		if err := runBulkItem(svc, item, tags); err != nil {
+			err = fmt.Errorf("%s: %w", item.Name, err)
+			log.Print(err)
+			errs = append(errs, err)
+		}
+	}
+
+	log.Printf("Bulk run finished: %d of %d item(s) succeeded", len(items)-len(errs), len(items))
+	for _, err := range errs {
+		log.Printf("  failed: %v", err)
+	}
+	return errors.Join(errs...)
+}
+
+func runBulkItem(svc *ec2.Client, item bulkItem, tags []types.Tag) error {
+	ipv4s, ipv6s, err := readIPsFromFile(item.File)
+	if err != nil {
+		return fmt.Errorf("failed to read IPs from file: %w", err)
+	}
+	tags = mergeTags(tags, tagsFromMap(item.Tags))
+	steps, err := prefixListSteps(svc, item.Action, item.Name, ipv4s, ipv6s, tags)
+	if err != nil {
+		return err
+	}
+	if err := runSteps(steps); err != nil {
+		return err
+	}
+	if item.Action == "update" && len(tags) > 0 {
+		return tagPrefixLists(svc, item.Name, tags)
+	}
+	return nil
+}
+
+// tagPrefixLists applies tags to the existing prefix lists stored under name,
+// replacing the values of tags they already carry.
+func tagPrefixLists(svc *ec2.Client, name string, tags []types.Tag) error {
+	prefixLists, err := resolvePrefixLists(svc, name, "")
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for _, pl := range prefixLists {
+		ids = append(ids, aws.ToString(pl.PrefixListId))
+	}
+	createTagsInput := &ec2.CreateTagsInput{
+		Resources: ids,
+		Tags:      tags,
+	}
+	if _, err := svc.CreateTags(context.TODO(), createTagsInput); err != nil {
+		return fmt.Errorf("failed to tag prefix lists: %w", err)
+	}
+	return nil
+}
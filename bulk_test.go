@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadBulkFileResolvesOnlyLocalPaths(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bulk.yaml")
+	bulk := `
+- name: local
+  file: ips/office.txt
+- name: absolute
+  file: /etc/prefix-lists/office.txt
+- name: url
+  file: https://example.com/ips.txt
+- name: s3
+  file: s3://bkt/key.txt
+- name: ssm
+  file: ssm://prod/cidrs
+`
+	if err := os.WriteFile(path, []byte(bulk), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := loadBulkFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"local":    filepath.Join(dir, "ips/office.txt"),
+		"absolute": "/etc/prefix-lists/office.txt",
+		"url":      "https://example.com/ips.txt",
+		"s3":       "s3://bkt/key.txt",
+		"ssm":      "ssm://prod/cidrs",
+	}
+	if len(items) != len(want) {
+		t.Fatalf("got %d items, want %d", len(items), len(want))
+	}
+	for _, item := range items {
+		if item.File != want[item.Name] {
+			t.Errorf("%s: file = %q, want %q", item.Name, item.File, want[item.Name])
+		}
+		if item.Action != "create" {
+			t.Errorf("%s: action = %q, want create", item.Name, item.Action)
+		}
+	}
+}
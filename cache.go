@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// cachedEntry is the on-disk form of a prefix list entry in -local-cache-dir.
+type cachedEntry struct {
+	CIDR        string `json:"cidr"`
+	Description string `json:"description,omitempty"`
+}
+
+// cachePath returns the cache file for a version of a prefix list. A version
+// never changes once created, so the version number is the only
+// invalidation needed.
+func cachePath(prefixListID string, version int64) string {
+	return filepath.Join(opts.cacheDir, fmt.Sprintf("%s-%d.json", prefixListID, version))
+}
+
+// readCachedEntries returns the cached entries of a version, if present.
+func readCachedEntries(prefixListID string, version int64) ([]types.PrefixListEntry, bool) {
+	data, err := os.ReadFile(cachePath(prefixListID, version))
+	if err != nil {
+		return nil, false
+	}
+	var cached []cachedEntry
+	if err := json.Unmarshal(data, &cached); err != nil {
+		log.Printf("Ignoring unreadable cache file %s: %v", cachePath(prefixListID, version), err)
+		return nil, false
+	}
+
+	entries := make([]types.PrefixListEntry, 0, len(cached))
+	for _, c := range cached {
+		entry := types.PrefixListEntry{Cidr: aws.String(c.CIDR)}
+		if c.Description != "" {
+			entry.Description = aws.String(c.Description)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, true
+}
+
+// writeCachedEntries stores the entries of a version. Failures only cost a
+// future API call, so they are logged rather than returned.
+func writeCachedEntries(prefixListID string, version int64, entries []types.PrefixListEntry) {
+	cached := make([]cachedEntry, 0, len(entries))
+	for _, entry := range entries {
+		cached = append(cached, cachedEntry{
+			CIDR:        aws.ToString(entry.Cidr),
+			Description: aws.ToString(entry.Description),
+		})
+	}
+	data, _ := json.Marshal(cached)
+
+	if err := os.MkdirAll(opts.cacheDir, 0o755); err != nil {
+		log.Printf("Failed to create cache directory: %v", err)
+		return
+	}
+	if err := os.WriteFile(cachePath(prefixListID, version), data, 0o644); err != nil {
+		log.Printf("Failed to write cache file: %v", err)
+	}
+}
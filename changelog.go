@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// operator is the caller identity recorded in -output-change-log and the
+// -auto-create-tags tags.
+var operator = "unknown"
+
+// loadOperator looks up the caller identity for the change log and tags.
+func loadOperator(cfg aws.Config) error {
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(context.TODO(), &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return fmt.Errorf("failed to get caller identity: %w", err)
+	}
+	operator = aws.ToString(identity.Arn)
+	return nil
+}
+
+// logChanges appends one line per added and removed entry to
+// -output-change-log, e.g.
+//
+//	2024-01-01T12:00:00Z ADD 10.0.0.0/8 (prefix-list: pl-xxx, version: 5, operator: arn:aws:iam::123456789012:user/me)
+//
+// version is the list version the change produced. Failures are logged, as
+// the change itself has already been made.
+func logChanges(prefixListID string, version int64, added []types.AddPrefixListEntry, removed []types.RemovePrefixListEntry) {
+	if opts.changeLogFile == "" || len(added)+len(removed) == 0 {
+		return
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	suffix := fmt.Sprintf("(prefix-list: %s, version: %d, operator: %s)", prefixListID, version, operator)
+	var b strings.Builder
+	for _, entry := range added {
+		fmt.Fprintf(&b, "%s ADD %s %s\n", now, aws.ToString(entry.Cidr), suffix)
+	}
+	for _, entry := range removed {
+		fmt.Fprintf(&b, "%s REMOVE %s %s\n", now, aws.ToString(entry.Cidr), suffix)
+	}
+
+	if _, err := writeOutputFile(opts.changeLogFile, []byte(b.String()), os.O_APPEND); err != nil {
+		log.Printf("Warning: failed to write change log: %v", err)
+	}
+}
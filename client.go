@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	"golang.org/x/time/rate"
+)
+
+// withRateLimit returns an API option that waits on limiter before every
+// operation sent by a client built from the config.
+func withRateLimit(limiter *rate.Limiter) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("RateLimit",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+				if err := limiter.Wait(ctx); err != nil {
+					return middleware.InitializeOutput{}, middleware.Metadata{}, err
+				}
+				return next.HandleInitialize(ctx, in)
+			}), middleware.Before)
+	}
+}
+
+// withCallCounter returns an API option that increments calls for every
+// operation sent by a client built from the config. Retries of an operation
+// are not counted separately.
+func withCallCounter(calls *atomic.Int64) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("CallCounter",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+				calls.Add(1)
+				return next.HandleInitialize(ctx, in)
+			}), middleware.Before)
+	}
+}
+
+// simulatedErrorKey marks, in the context of an operation, the batch
+// withSimulatedError fails.
+type simulatedErrorKey struct{}
+
+// withSimulatedError returns an API option that fails the batch-th create or
+// modify prefix list batch with a synthetic throttling error, counting from
+// 1. ModifyManagedPrefixList calls that only change MaxEntries are not
+// batches and are not counted. The error is raised after the SDK's retry
+// step, on every attempt, so the batch is retried as a throttled call would
+// be and then fails once the retries are exhausted. Nothing is sent for the
+// failed batch; every other call goes to AWS.
+func withSimulatedError(batch int64) func(*middleware.Stack) error {
+	var calls atomic.Int64
+	return func(stack *middleware.Stack) error {
+		err := stack.Initialize.Add(middleware.InitializeMiddlewareFunc("SimulatedErrorCounter",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+				if isBatchCall(in.Parameters) && calls.Add(1) == batch {
+					ctx = middleware.WithStackValue(ctx, simulatedErrorKey{}, true)
+				}
+				return next.HandleInitialize(ctx, in)
+			}), middleware.After)
+		if err != nil {
+			return err
+		}
+		simulate := middleware.FinalizeMiddlewareFunc("SimulatedError",
+			func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+				if fail, _ := middleware.GetStackValue(ctx, simulatedErrorKey{}).(bool); fail {
+					return middleware.FinalizeOutput{}, middleware.Metadata{}, &smithy.GenericAPIError{
+						Code:    "RequestLimitExceeded",
+						Message: fmt.Sprintf("simulated error on batch %d", batch),
+					}
+				}
+				return next.HandleFinalize(ctx, in)
+			})
+		if _, ok := stack.Finalize.Get("Retry"); !ok {
+			return stack.Finalize.Add(simulate, middleware.Before)
+		}
+		return stack.Finalize.Insert(simulate, "Retry", middleware.After)
+	}
+}
+
+// isBatchCall reports whether params are those of a call that creates a
+// prefix list or changes its entries.
+func isBatchCall(params any) bool {
+	switch p := params.(type) {
+	case *ec2.CreateManagedPrefixListInput:
+		return true
+	case *ec2.ModifyManagedPrefixListInput:
+		return len(p.AddEntries) > 0 || len(p.RemoveEntries) > 0
+	}
+	return false
+}
+
+// isThrottlingError reports whether err is an API request rate error.
+func isThrottlingError(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.ErrorCode() {
+	case "RequestLimitExceeded", "Throttling", "ThrottlingException":
+		return true
+	}
+	return false
+}
+
+// stsAPI is the part of the STS client used to assume a role.
+type stsAPI interface {
+	stscreds.AssumeRoleAPIClient
+	stscreds.AssumeRoleWithWebIdentityAPIClient
+}
+
+// assumeRoleProvider returns cached credentials for roleARN. When a web
+// identity token file is given, or set by IRSA in AWS_WEB_IDENTITY_TOKEN_FILE,
+// the role is assumed with AssumeRoleWithWebIdentity; otherwise AssumeRole is
+// called with the credentials already in cfg.
+func assumeRoleProvider(cfg aws.Config, roleARN, tokenFile, sessionName string) aws.CredentialsProvider {
+	return newAssumeRoleProvider(sts.NewFromConfig(cfg), roleARN, tokenFile, sessionName)
+}
+
+func newAssumeRoleProvider(client stsAPI, roleARN, tokenFile, sessionName string) aws.CredentialsProvider {
+	if tokenFile == "" {
+		tokenFile = os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+	}
+	if tokenFile != "" {
+		return aws.NewCredentialsCache(stscreds.NewWebIdentityRoleProvider(client, roleARN, stscreds.IdentityTokenFile(tokenFile),
+			func(o *stscreds.WebIdentityRoleOptions) {
+				o.RoleSessionName = sessionName
+			}))
+	}
+	return aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(client, roleARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = sessionName
+	}))
+}
+
+// preFlightCheck makes one read-only EC2 call to confirm the credentials,
+// region and network path work before anything is modified. The result is
+// reported along with the region and caller identity.
+func preFlightCheck(cfg aws.Config, svc *ec2.Client) error {
+	var identity string
+	if out, err := sts.NewFromConfig(cfg).GetCallerIdentity(context.TODO(), &sts.GetCallerIdentityInput{}); err != nil {
+		identity = fmt.Sprintf("unknown (%v)", err)
+	} else {
+		identity = aws.ToString(out.Arn)
+	}
+
+	_, err := svc.DescribeManagedPrefixLists(context.TODO(), &ec2.DescribeManagedPrefixListsInput{
+		MaxResults: aws.Int32(5),
+	})
+	if err != nil {
+		return fmt.Errorf("pre-flight check failed (region: %s, identity: %s): %w", cfg.Region, identity, err)
+	}
+	log.Printf("Pre-flight check passed (region: %s, identity: %s)", cfg.Region, identity)
+	return nil
+}
+
+// testCredentials prints the caller identity of the credentials in cfg. It
+// needs no permissions beyond what every identity has.
+func testCredentials(cfg aws.Config) error {
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(context.TODO(), &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return fmt.Errorf("failed to get caller identity: %w", err)
+	}
+	if jsonOutput() {
+		printJSON(struct {
+			Account string `json:"account"`
+			ARN     string `json:"arn"`
+			UserID  string `json:"userId"`
+		}{aws.ToString(identity.Account), aws.ToString(identity.Arn), aws.ToString(identity.UserId)})
+		return nil
+	}
+	fmt.Printf("Account: %s\n", aws.ToString(identity.Account))
+	fmt.Printf("ARN:     %s\n", aws.ToString(identity.Arn))
+	fmt.Printf("User ID: %s\n", aws.ToString(identity.UserId))
+	return nil
+}
+
+// verifyAccount fails unless the credentials in cfg belong to the expected
+// AWS account.
+func verifyAccount(cfg aws.Config, expected string) error {
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(context.TODO(), &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return fmt.Errorf("failed to get caller identity: %w", err)
+	}
+	if account := aws.ToString(identity.Account); account != expected {
+		return fmt.Errorf("credentials belong to account %s, expected %s", account, expected)
+	}
+	return nil
+}
+
+// newHTTPClient returns the client used to download URL-based IP files,
+// configured with the -http-timeout, -connect-timeout,
+// -tls-handshake-timeout and -ca-bundle flags.
+func newHTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   opts.connectTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = opts.tlsHandshakeTimeout
+	if opts.rootCAs != nil {
+		transport.TLSClientConfig = &tls.Config{RootCAs: opts.rootCAs}
+	}
+	return &http.Client{
+		Timeout:   opts.httpTimeout,
+		Transport: transport,
+	}
+}
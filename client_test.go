@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	ststypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+// fakeSTS returns credentials that have already expired, numbered by call,
+// and records the web identity tokens it was given.
+type fakeSTS struct {
+	tokens       []string
+	sessionNames []string
+	assumeRoles  int
+}
+
+func (f *fakeSTS) AssumeRoleWithWebIdentity(_ context.Context, in *sts.AssumeRoleWithWebIdentityInput, _ ...func(*sts.Options)) (*sts.AssumeRoleWithWebIdentityOutput, error) {
+	f.tokens = append(f.tokens, aws.ToString(in.WebIdentityToken))
+	f.sessionNames = append(f.sessionNames, aws.ToString(in.RoleSessionName))
+	return &sts.AssumeRoleWithWebIdentityOutput{
+		Credentials: &ststypes.Credentials{
+			AccessKeyId:     aws.String("AKID" + strconv.Itoa(len(f.tokens))),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("session"),
+			Expiration:      aws.Time(time.Now().Add(-time.Minute)),
+		},
+	}, nil
+}
+
+func (f *fakeSTS) AssumeRole(context.Context, *sts.AssumeRoleInput, ...func(*sts.Options)) (*sts.AssumeRoleOutput, error) {
+	f.assumeRoles++
+	return &sts.AssumeRoleOutput{
+		Credentials: &ststypes.Credentials{
+			AccessKeyId:     aws.String("AKID"),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("session"),
+			Expiration:      aws.Time(time.Now().Add(time.Hour)),
+		},
+	}, nil
+}
+
+func TestAssumeRoleProviderWebIdentityTokenFileFromEnv(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("first-token"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", tokenFile)
+
+	client := &fakeSTS{}
+	provider := newAssumeRoleProvider(client, "arn:aws:iam::123456789012:role/test", "", "test-session")
+
+	creds, err := provider.Retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AccessKeyID != "AKID1" {
+		t.Errorf("AccessKeyID = %q, want AKID1", creds.AccessKeyID)
+	}
+
+	// The credentials have expired, so the next retrieval assumes the role
+	// again, reading the token file afresh as IRSA rotates it.
+	if err := os.WriteFile(tokenFile, []byte("second-token"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	creds, err = provider.Retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AccessKeyID != "AKID2" {
+		t.Errorf("AccessKeyID after refresh = %q, want AKID2", creds.AccessKeyID)
+	}
+
+	if want := []string{"first-token", "second-token"}; len(client.tokens) != 2 || client.tokens[0] != want[0] || client.tokens[1] != want[1] {
+		t.Errorf("tokens = %q, want %q", client.tokens, want)
+	}
+	for _, name := range client.sessionNames {
+		if name != "test-session" {
+			t.Errorf("RoleSessionName = %q, want test-session", name)
+		}
+	}
+	if client.assumeRoles != 0 {
+		t.Errorf("AssumeRole called %d times, want 0", client.assumeRoles)
+	}
+}
+
+func TestAssumeRoleProviderWithoutTokenFile(t *testing.T) {
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "")
+
+	client := &fakeSTS{}
+	provider := newAssumeRoleProvider(client, "arn:aws:iam::123456789012:role/test", "", "test-session")
+	for range 2 {
+		if _, err := provider.Retrieve(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Unexpired credentials are served from the cache.
+	if client.assumeRoles != 1 {
+		t.Errorf("AssumeRole called %d times, want 1", client.assumeRoles)
+	}
+	if len(client.tokens) != 0 {
+		t.Errorf("AssumeRoleWithWebIdentity called %d times, want 0", len(client.tokens))
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// sensitiveFlags and sensitiveEnv hold values -print-config masks.
+var (
+	sensitiveFlags = map[string]bool{
+		"aws-secret-access-key": true,
+		"aws-session-token":     true,
+		"webhook-url":           true,
+	}
+	sensitiveEnv = map[string]bool{
+		"AWS_SECRET_ACCESS_KEY": true,
+		"AWS_SESSION_TOKEN":     true,
+	}
+)
+
+// printConfig writes the effective configuration to stderr as YAML: every
+// flag with its value, whether set or defaulted, the AWS and proxy
+// environment variables, and the resolved region. Secrets are masked.
+func printConfig(region string) {
+	flags := make(map[string]string)
+	flag.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if sensitiveFlags[f.Name] && value != "" {
+			value = "***"
+		}
+		flags[f.Name] = value
+	})
+
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		upper := strings.ToUpper(key)
+		if !strings.HasPrefix(upper, "AWS_") && upper != "HTTP_PROXY" && upper != "HTTPS_PROXY" && upper != "NO_PROXY" {
+			continue
+		}
+		if sensitiveEnv[upper] && value != "" {
+			value = "***"
+		}
+		env[key] = value
+	}
+
+	out, _ := yaml.Marshal(struct {
+		Region      string            `yaml:"region"`
+		Flags       map[string]string `yaml:"flags"`
+		Environment map[string]string `yaml:"environment"`
+	}{region, flags, env})
+	fmt.Fprint(os.Stderr, string(out))
+}
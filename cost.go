@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// hoursPerMonth is the average number of hours in a month, as used by AWS
+// pricing.
+const hoursPerMonth = 730
+
+// costEstimate is the projected monthly usage of one prefix list.
+type costEstimate struct {
+	Name          string  `json:"name"`
+	ID            string  `json:"id,omitempty"`
+	AddressFamily string  `json:"addressFamily"`
+	Entries       int     `json:"entries"`
+	MaxEntries    int     `json:"maxEntries"`
+	Associations  int     `json:"associations"`
+	EntryHours    int64   `json:"entryHoursPerMonth"`
+	MonthlyCost   float64 `json:"estimatedMonthlyCostUsd"`
+}
+
+// estimateCosts prints the projected monthly entry-hours of the lists that
+// create or update would write, and their cost at -cost-per-entry-hour.
+// Each security group or route table referencing a list counts its
+// MaxEntries against that resource's quota, so the entry-hours are
+// MaxEntries times the number of referencing resources, or once for a list
+// that is not referenced yet. Lists that do not exist yet are estimated
+// with the MaxEntries create would give them.
+func estimateCosts(svc *ec2.Client, name, prefixListID string, ipv4s, ipv6s []prefixEntry) error {
+	// existing holds the live list of each target, or nil for a list
+	// create would make. A list given by ID is used as described, since
+	// names are not unique.
+	var targets []prefixListTarget
+	var existing []*types.ManagedPrefixList
+	if prefixListID != "" {
+		pl, err := describePrefixList(svc, prefixListID)
+		if err != nil {
+			return err
+		}
+		t := prefixListTarget{aws.ToString(pl.PrefixListName), aws.ToString(pl.AddressFamily), ipv4s}
+		if t.addressFamily == "IPv6" {
+			t.ips = ipv6s
+		}
+		targets = append(targets, t)
+		existing = append(existing, pl)
+	} else {
+		var err error
+		if targets, err = prefixListTargets(name, ipv4s, ipv6s); err != nil {
+			return err
+		}
+		for _, t := range targets {
+			pl, err := findPrefixListByName(svc, t.name)
+			if err != nil {
+				return err
+			}
+			existing = append(existing, pl)
+		}
+	}
+
+	var estimates []costEstimate
+	for i, t := range targets {
+		e := costEstimate{
+			Name:          t.name,
+			AddressFamily: t.addressFamily,
+			Entries:       len(t.ips),
+			MaxEntries:    maxEntriesWithHeadroom(len(t.ips)),
+		}
+		if pl := existing[i]; pl != nil {
+			var err error
+			e.ID = aws.ToString(pl.PrefixListId)
+			// An update only raises MaxEntries when the entries need it.
+			e.MaxEntries = max(e.MaxEntries, int(aws.ToInt32(pl.MaxEntries)))
+			if e.Associations, err = countAssociations(svc, e.ID); err != nil {
+				return err
+			}
+		}
+		e.EntryHours = int64(e.MaxEntries) * hoursPerMonth * int64(max(e.Associations, 1))
+		e.MonthlyCost = float64(e.EntryHours) * opts.costPerEntryHour
+		estimates = append(estimates, e)
+	}
+
+	printCostEstimates(estimates)
+	log.Printf("Note: AWS does not currently charge for customer-managed prefix lists; the estimate assumes $%g per entry-hour (-cost-per-entry-hour). Check current AWS pricing before relying on it.", opts.costPerEntryHour)
+	return nil
+}
+
+// countAssociations returns the number of resources, such as security
+// groups and route tables, that reference the list.
+func countAssociations(svc *ec2.Client, prefixListID string) (int, error) {
+	input := &ec2.GetManagedPrefixListAssociationsInput{PrefixListId: aws.String(prefixListID)}
+	var associations []types.PrefixListAssociation
+	paginator := ec2.NewGetManagedPrefixListAssociationsPaginator(svc, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return 0, fmt.Errorf("failed to get prefix list associations: %w", err)
+		}
+		associations = append(associations, page.PrefixListAssociations...)
+	}
+	return len(associations), nil
+}
+
+func printCostEstimates(estimates []costEstimate) {
+	if jsonOutput() {
+		printJSON(estimates)
+		return
+	}
+	if opts.output == "table" {
+		w := newTableWriter()
+		fmt.Fprintln(w, "NAME\tID\tFAMILY\tENTRIES\tMAX ENTRIES\tASSOCIATIONS\tENTRY-HOURS/MONTH\tEST. USD/MONTH")
+		for _, e := range estimates {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%d\t$%.2f\n", e.Name, e.ID, e.AddressFamily, e.Entries, e.MaxEntries, e.Associations, e.EntryHours, e.MonthlyCost)
+		}
+		w.Flush()
+		return
+	}
+	for _, e := range estimates {
+		fmt.Printf("%s\t%s\t%s\t%d\t%d\t%d\t%d\t$%.2f\n", e.Name, e.ID, e.AddressFamily, e.Entries, e.MaxEntries, e.Associations, e.EntryHours, e.MonthlyCost)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// dnsCache holds the addresses of each hostname resolved by -verify-dns
+// during the current run, so that a hostname listed in several places is
+// looked up once.
+var dnsCache map[string][]string
+
+// resolveHostnames replaces every entry that is not a CIDR with a /32 or
+// /128 entry for each address its hostname resolves to, keeping the
+// entry's description. A "/32"-style suffix on the hostname is ignored.
+// Hostnames that don't resolve are dropped with a warning.
+func resolveHostnames(entries []prefixEntry) []prefixEntry {
+	if dnsCache == nil {
+		dnsCache = make(map[string][]string)
+	}
+	var resolved []prefixEntry
+	for _, entry := range entries {
+		value := strings.TrimSpace(entry.CIDR)
+		if _, _, err := net.ParseCIDR(value); err == nil || value == "" {
+			resolved = append(resolved, entry)
+			continue
+		}
+		host, _, _ := strings.Cut(value, "/")
+		addrs, cached := dnsCache[host]
+		if !cached {
+			var err error
+			if addrs, err = net.LookupHost(host); err != nil {
+				log.Printf("Warning: failed to resolve %s: %v", host, err)
+			}
+			dnsCache[host] = addrs
+		}
+		for _, a := range addrs {
+			addr, err := netip.ParseAddr(a)
+			if err != nil {
+				continue
+			}
+			addr = addr.Unmap().WithZone("")
+			resolved = append(resolved, prefixEntry{
+				CIDR:        netip.PrefixFrom(addr, addr.BitLen()).String(),
+				Description: entry.Description,
+			})
+		}
+	}
+	return resolved
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// prefixListVersion is one entry in the modification history of a list.
+type prefixListVersion struct {
+	Version    int64    `json:"version"`
+	EntryCount int      `json:"entryCount"`
+	Add        []string `json:"add,omitempty"`
+	Remove     []string `json:"remove,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+type prefixListHistory struct {
+	Name     string              `json:"name"`
+	ID       string              `json:"id"`
+	State    string              `json:"state"`
+	Versions []prefixListVersion `json:"versions"`
+}
+
+// showPrefixListEvents prints the version history of the named lists, or
+// of the list with the given ID.
+//
+// EC2 has no API that returns the timestamp or principal behind a version,
+// so the history is rebuilt from GetManagedPrefixListEntries with
+// TargetVersion, one call per version. Use CloudTrail for who and when.
+func showPrefixListEvents(svc *ec2.Client, name, prefixListID string, showDiff bool) error {
+	prefixLists, err := resolvePrefixLists(svc, name, prefixListID)
+	if err != nil {
+		return err
+	}
+
+	var histories []prefixListHistory
+	for _, pl := range prefixLists {
+		history := getPrefixListHistory(svc, aws.ToString(pl.PrefixListId), 1, aws.ToInt64(pl.Version), showDiff)
+		history.Name = aws.ToString(pl.PrefixListName)
+		history.State = string(pl.State)
+		histories = append(histories, history)
+	}
+
+	if jsonOutput() {
+		printJSON(histories)
+		return nil
+	}
+	for _, h := range histories {
+		fmt.Printf("%s (%s), state %s\n", h.Name, h.ID, h.State)
+		for _, v := range h.Versions {
+			if v.Error != "" {
+				fmt.Printf("  version %d: unavailable (%s)\n", v.Version, v.Error)
+				continue
+			}
+			fmt.Printf("  version %d: %d entries\n", v.Version, v.EntryCount)
+			for _, cidr := range v.Add {
+				fmt.Println(colorize(ansiGreen, "    + "+cidr))
+			}
+			for _, cidr := range v.Remove {
+				fmt.Println(colorize(ansiRed, "    - "+cidr))
+			}
+		}
+	}
+	return nil
+}
+
+// listVersions prints a table of the versions of the named lists, or of the
+// list with the given ID, with the entry count of each, newest first. With
+// limit above 0, only the limit most recent versions are shown.
+//
+// EC2 has no DescribeManagedPrefixListVersions API, so versions carry no
+// creation time; each is read with GetManagedPrefixListEntries and
+// TargetVersion, one call per version.
+func listVersions(svc *ec2.Client, name, prefixListID string, limit int64) error {
+	prefixLists, err := resolvePrefixLists(svc, name, prefixListID)
+	if err != nil {
+		return err
+	}
+
+	var histories []prefixListHistory
+	for _, pl := range prefixLists {
+		current := aws.ToInt64(pl.Version)
+		first := int64(1)
+		if limit > 0 {
+			first = max(1, current-limit+1)
+		}
+		history := getPrefixListHistory(svc, aws.ToString(pl.PrefixListId), first, current, false)
+		history.Name = aws.ToString(pl.PrefixListName)
+		history.State = string(pl.State)
+		slices.Reverse(history.Versions)
+		histories = append(histories, history)
+	}
+
+	if jsonOutput() {
+		printJSON(histories)
+		return nil
+	}
+	w := newTableWriter()
+	fmt.Fprintln(w, "NAME\tID\tVERSION\tENTRIES\tSTATUS")
+	for _, h := range histories {
+		for _, v := range h.Versions {
+			if v.Error != "" {
+				fmt.Fprintf(w, "%s\t%s\t%d\t\tunavailable (%s)\n", h.Name, h.ID, v.Version, v.Error)
+				continue
+			}
+			status := "retained"
+			if v.Version == h.Versions[0].Version {
+				status = "current"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\n", h.Name, h.ID, v.Version, v.EntryCount, status)
+		}
+	}
+	w.Flush()
+	return nil
+}
+
+// versionComparison is the difference between two versions of a list.
+type versionComparison struct {
+	Name     string   `json:"name"`
+	ID       string   `json:"id"`
+	VersionA int64    `json:"versionA"`
+	VersionB int64    `json:"versionB"`
+	Add      []string `json:"add,omitempty"`
+	Remove   []string `json:"remove,omitempty"`
+}
+
+// compareVersions prints the entries added and removed between versionA and
+// versionB of the named lists, or of the list with the given ID. Like the
+// history, both versions are read with GetManagedPrefixListEntries and
+// TargetVersion, so they must still be retained by EC2.
+func compareVersions(svc *ec2.Client, name, prefixListID string, versionA, versionB int64) error {
+	prefixLists, err := resolvePrefixLists(svc, name, prefixListID)
+	if err != nil {
+		return err
+	}
+
+	var comparisons []versionComparison
+	for _, pl := range prefixLists {
+		id := aws.ToString(pl.PrefixListId)
+		if current := aws.ToInt64(pl.Version); versionA > current || versionB > current {
+			return fmt.Errorf("prefix list %s is at version %d", id, current)
+		}
+		entriesA, err := getPrefixListEntriesAtVersion(svc, id, versionA)
+		if err != nil {
+			return fmt.Errorf("failed to get version %d of %s: %w", versionA, id, err)
+		}
+		entriesB, err := getPrefixListEntriesAtVersion(svc, id, versionB)
+		if err != nil {
+			return fmt.Errorf("failed to get version %d of %s: %w", versionB, id, err)
+		}
+		c := versionComparison{Name: aws.ToString(pl.PrefixListName), ID: id, VersionA: versionA, VersionB: versionB}
+		c.Add, c.Remove = diffEntries(entriesA, entriesB)
+		slices.SortFunc(c.Add, compareCIDRs)
+		slices.SortFunc(c.Remove, compareCIDRs)
+		comparisons = append(comparisons, c)
+	}
+
+	if jsonOutput() {
+		printJSON(comparisons)
+		return nil
+	}
+	for _, c := range comparisons {
+		fmt.Printf("%s (%s), version %d to %d: %d added, %d removed\n", c.Name, c.ID, c.VersionA, c.VersionB, len(c.Add), len(c.Remove))
+		for _, cidr := range c.Add {
+			fmt.Println(colorize(ansiGreen, "  + "+cidr))
+		}
+		for _, cidr := range c.Remove {
+			fmt.Println(colorize(ansiRed, "  - "+cidr))
+		}
+	}
+	return nil
+}
+
+// getPrefixListHistory fetches the entries of every version from first up
+// to current. Versions EC2 no longer retains are reported with an error
+// instead of failing the whole history.
+func getPrefixListHistory(svc *ec2.Client, prefixListID string, first, current int64, showDiff bool) prefixListHistory {
+	history := prefixListHistory{ID: prefixListID}
+	var previous []string
+	for version := first; version <= current; version++ {
+		entries, err := getPrefixListEntriesAtVersion(svc, prefixListID, version)
+		if err != nil {
+			history.Versions = append(history.Versions, prefixListVersion{Version: version, Error: err.Error()})
+			previous = nil
+			continue
+		}
+		v := prefixListVersion{Version: version, EntryCount: len(entries)}
+		if showDiff {
+			v.Add, v.Remove = diffEntries(previous, entries)
+		}
+		history.Versions = append(history.Versions, v)
+		previous = entries
+	}
+	return history
+}
+
+// addedVersions returns the version in which each of the current entries was
+// added, meaning the first version of the unbroken run of versions that
+// ends at current and holds the entry. It walks back one version at a time
+// until every entry is accounted for. If an older version is no longer
+// retained, the remaining entries are reported as added in the oldest
+// version available.
+func addedVersions(svc *ec2.Client, prefixListID string, current int64, entries []types.PrefixListEntry) map[string]int64 {
+	added := make(map[string]int64, len(entries))
+	pending := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		added[aws.ToString(entry.Cidr)] = current
+		pending[aws.ToString(entry.Cidr)] = true
+	}
+
+	for version := current - 1; version >= 1 && len(pending) > 0; version-- {
+		cidrs, err := getPrefixListEntriesAtVersion(svc, prefixListID, version)
+		if err != nil {
+			break
+		}
+		present := make(map[string]bool, len(cidrs))
+		for _, cidr := range cidrs {
+			present[cidr] = true
+		}
+		for cidr := range pending {
+			if present[cidr] {
+				added[cidr] = version
+			} else {
+				delete(pending, cidr)
+			}
+		}
+	}
+	return added
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+// expiresAtPrefix marks the expiry time -entry-ttl appends to an entry's
+// description, e.g. "ExpiresAt=2024-01-02T12:00:00Z".
+const expiresAtPrefix = "ExpiresAt="
+
+// entryExpiry returns the expiry time recorded in an entry description, if
+// any.
+func entryExpiry(description string) (time.Time, bool) {
+	for _, field := range strings.Fields(description) {
+		value, ok := strings.CutPrefix(field, expiresAtPrefix)
+		if !ok {
+			continue
+		}
+		expiresAt, err := time.Parse(time.RFC3339, value)
+		return expiresAt, err == nil
+	}
+	return time.Time{}, false
+}
+
+// expirePrefixListEntries removes the entries whose ExpiresAt time has
+// passed from the named lists, or from the list with the given ID.
+func expirePrefixListEntries(svc *ec2.Client, name, prefixListID string) error {
+	prefixLists, err := resolvePrefixLists(svc, name, prefixListID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, pl := range prefixLists {
+		id := aws.ToString(pl.PrefixListId)
+		current, err := listPrefixListEntries(svc, id, 0)
+		if err != nil {
+			return err
+		}
+
+		var keep []prefixEntry
+		expired := 0
+		for _, entry := range current {
+			if expiresAt, ok := entryExpiry(aws.ToString(entry.Description)); ok && expiresAt.Before(now) {
+				log.Printf("Entry %s in %s expired at %s", aws.ToString(entry.Cidr), id, expiresAt.Format(time.RFC3339))
+				expired++
+				continue
+			}
+			keep = append(keep, prefixEntry{CIDR: aws.ToString(entry.Cidr), Description: aws.ToString(entry.Description)})
+		}
+		if expired == 0 {
+			log.Printf("No expired entries in %s", id)
+			continue
+		}
+		if err := updatePrefixListByID(svc, id, keep); err != nil {
+			return err
+		}
+		log.Printf("Removed %d expired entries from %s", expired, id)
+	}
+	return nil
+}
+
+// purgePrefixLists removes every entry from the named lists, or from the
+// list with the given ID, leaving them empty but in place so references to
+// them keep working. Unlike update it removes entries regardless of
+// -entry-description-prefix and never deletes the emptied list.
+func purgePrefixLists(svc *ec2.Client, name, prefixListID string) error {
+	prefixLists, err := resolvePrefixLists(svc, name, prefixListID)
+	if err != nil {
+		return err
+	}
+	for _, pl := range prefixLists {
+		id := aws.ToString(pl.PrefixListId)
+		m := newOperationReport("update")
+		current, err := listPrefixListEntries(svc, id, 0)
+		if err != nil {
+			return err
+		}
+		toRemove := make([]string, len(current))
+		for i, entry := range current {
+			toRemove[i] = aws.ToString(entry.Cidr)
+		}
+		if err := applyPrefixListChanges(svc, m, id, current, nil, toRemove); err != nil {
+			return err
+		}
+		log.Printf("Purged prefix list %s", id)
+	}
+	return nil
+}
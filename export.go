@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// exportAWSCLI prints a shell script of aws ec2 commands that recreate the
+// named lists, or the list with the given ID, from scratch with their
+// current entries, MaxEntries and tags. Like the tool, the script creates
+// each list with the first 100 entries and adds the rest 100 at a time,
+// waiting for the list to settle in between.
+func exportAWSCLI(svc *ec2.Client, name, prefixListID string) error {
+	prefixLists, err := resolvePrefixLists(svc, name, prefixListID)
+	if err != nil {
+		return err
+	}
+
+	const maxEntriesPerRequest = 100
+	fmt.Println("#!/bin/sh")
+	fmt.Println("set -e")
+	for _, pl := range prefixLists {
+		entries, err := listPrefixListEntries(svc, aws.ToString(pl.PrefixListId), 0)
+		if err != nil {
+			return err
+		}
+		type cliEntry struct {
+			Cidr        string
+			Description string `json:",omitempty"`
+		}
+		var batches [][]cliEntry
+		for start := 0; start < len(entries) || start == 0; start += maxEntriesPerRequest {
+			var batch []cliEntry
+			for _, entry := range entries[start:min(start+maxEntriesPerRequest, len(entries))] {
+				batch = append(batch, cliEntry{aws.ToString(entry.Cidr), aws.ToString(entry.Description)})
+			}
+			batches = append(batches, batch)
+		}
+
+		fmt.Printf("\n# %s (%s), version %d\n", aws.ToString(pl.PrefixListName), aws.ToString(pl.PrefixListId), aws.ToInt64(pl.Version))
+		create := []string{
+			"PL_ID=$(aws ec2 create-managed-prefix-list",
+			"--prefix-list-name " + shellQuote(aws.ToString(pl.PrefixListName)),
+			"--address-family " + aws.ToString(pl.AddressFamily),
+			fmt.Sprintf("--max-entries %d", aws.ToInt32(pl.MaxEntries)),
+		}
+		if len(batches[0]) > 0 {
+			create = append(create, "--entries "+shellQuote(mustJSON(batches[0])))
+		}
+		if tags := cliTags(pl.Tags); len(tags) > 0 {
+			create = append(create, "--tag-specifications "+shellQuote(mustJSON([]any{map[string]any{
+				"ResourceType": "prefix-list",
+				"Tags":         tags,
+			}})))
+		}
+		create = append(create, "--query PrefixList.PrefixListId --output text)")
+		fmt.Println(strings.Join(create, " \\\n  "))
+
+		state := "create-complete"
+		for i, batch := range batches[1:] {
+			printWaitCommand(state)
+			fmt.Println(strings.Join([]string{
+				"aws ec2 modify-managed-prefix-list",
+				`--prefix-list-id "$PL_ID"`,
+				fmt.Sprintf("--current-version %d", i+1),
+				"--add-entries " + shellQuote(mustJSON(batch)),
+				">/dev/null",
+			}, " \\\n  "))
+			state = "modify-complete"
+		}
+		printWaitCommand(state)
+		fmt.Println(`echo "Created $PL_ID"`)
+	}
+	return nil
+}
+
+// printWaitCommand prints a loop that polls until the list in $PL_ID reaches
+// state, as the AWS CLI has no waiter for prefix lists.
+func printWaitCommand(state string) {
+	fmt.Printf("until [ \"$(aws ec2 describe-managed-prefix-lists --prefix-list-ids \"$PL_ID\" --query 'PrefixLists[0].State' --output text)\" = %s ]; do sleep 2; done\n", state)
+}
+
+// cliTags returns the tags of a list that can be set by a user, in the
+// form the AWS CLI takes them.
+func cliTags(tags []types.Tag) []map[string]string {
+	var out []map[string]string
+	for _, tag := range tags {
+		if strings.HasPrefix(aws.ToString(tag.Key), "aws:") {
+			continue
+		}
+		out = append(out, map[string]string{"Key": aws.ToString(tag.Key), "Value": redactTagValue(aws.ToString(tag.Key), aws.ToString(tag.Value))})
+	}
+	return out
+}
+
+func mustJSON(v any) string {
+	out, _ := json.Marshal(v)
+	return string(out)
+}
+
+// shellQuote quotes s as a single POSIX shell word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
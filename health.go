@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// healthCheck is the outcome of one check made by the health action.
+type healthCheck struct {
+	Check  string `json:"check"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail"`
+}
+
+// checkHealth verifies the credentials, EC2 access and, when a name or ID is
+// given, that the prefix lists exist, are active and hold between
+// minEntries and maxEntries entries (0 means no upper bound). It prints
+// every check and fails if any of them did.
+func checkHealth(cfg aws.Config, svc *ec2.Client, name, prefixListID string, minEntries, maxEntries int) error {
+	var checks []healthCheck
+	record := func(check string, err error, detail string) {
+		if err != nil {
+			detail = err.Error()
+		}
+		checks = append(checks, healthCheck{Check: check, Passed: err == nil, Detail: detail})
+	}
+
+	var callerARN string
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(context.TODO(), &sts.GetCallerIdentityInput{})
+	if err == nil {
+		callerARN = aws.ToString(identity.Arn)
+	}
+	record("credentials", err, callerARN)
+
+	_, err = svc.DescribeManagedPrefixLists(context.TODO(), &ec2.DescribeManagedPrefixListsInput{
+		MaxResults: aws.Int32(5),
+	})
+	record("ec2-access", err, "ec2:DescribeManagedPrefixLists allowed in "+cfg.Region)
+
+	if name != "" || prefixListID != "" {
+		prefixLists, err := resolvePrefixLists(svc, name, prefixListID)
+		record("prefix-lists", err, fmt.Sprintf("%d prefix list(s) found", len(prefixLists)))
+		for _, pl := range prefixLists {
+			id := aws.ToString(pl.PrefixListId)
+			check := aws.ToString(pl.PrefixListName)
+
+			state := string(pl.State)
+			var stateErr error
+			if !strings.HasSuffix(state, "-complete") {
+				stateErr = fmt.Errorf("%s is %s", id, state)
+			}
+			record(check+" state", stateErr, fmt.Sprintf("%s is %s", id, state))
+
+			if minEntries == 0 && maxEntries == 0 {
+				continue
+			}
+			entries, err := getPrefixListEntries(svc, id)
+			if err == nil && (len(entries) < minEntries || (maxEntries > 0 && len(entries) > maxEntries)) {
+				err = fmt.Errorf("%s has %d entries, %s", id, len(entries), entryBounds(minEntries, maxEntries))
+			}
+			record(check+" entries", err, fmt.Sprintf("%s has %d entries", id, len(entries)))
+		}
+	}
+
+	printHealthChecks(checks)
+
+	failed := 0
+	for _, c := range checks {
+		if !c.Passed {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d health check(s) failed", failed, len(checks))
+	}
+	return nil
+}
+
+// entryBounds describes the range -min-entries and -max-entries allow.
+func entryBounds(minEntries, maxEntries int) string {
+	if maxEntries == 0 {
+		return fmt.Sprintf("expected at least %d", minEntries)
+	}
+	return fmt.Sprintf("expected %d to %d", minEntries, maxEntries)
+}
+
+func printHealthChecks(checks []healthCheck) {
+	if jsonOutput() {
+		printJSON(checks)
+		return
+	}
+	if opts.output == "table" {
+		w := newTableWriter()
+		fmt.Fprintln(w, "CHECK\tSTATUS\tDETAIL")
+		for _, c := range checks {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", c.Check, healthStatus(c.Passed), c.Detail)
+		}
+		w.Flush()
+		return
+	}
+	for _, c := range checks {
+		status := colorize(ansiGreen, healthStatus(c.Passed))
+		if !c.Passed {
+			status = colorize(ansiRed, healthStatus(c.Passed))
+		}
+		fmt.Printf("%s %s: %s\n", status, c.Check, c.Detail)
+	}
+}
+
+func healthStatus(passed bool) string {
+	if passed {
+		return "PASS"
+	}
+	return "FAIL"
+}
@@ -0,0 +1,486 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// prefixEntry is a CIDR read from the IP file with its optional
+// description.
+type prefixEntry struct {
+	CIDR        string `json:"cidr" yaml:"cidr"`
+	Description string `json:"description,omitempty" yaml:"description"`
+}
+
+// UnmarshalJSON accepts either a bare CIDR string or an object.
+func (e *prefixEntry) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &e.CIDR); err == nil {
+		return nil
+	}
+	type plain prefixEntry
+	return json.Unmarshal(data, (*plain)(e))
+}
+
+// UnmarshalYAML accepts either a bare CIDR string or a mapping.
+func (e *prefixEntry) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		e.CIDR = node.Value
+		return nil
+	}
+	type plain prefixEntry
+	return node.Decode((*plain)(e))
+}
+
+// cidrsOf returns the CIDRs of entries, in order.
+func cidrsOf(entries []prefixEntry) []string {
+	cidrs := make([]string, 0, len(entries))
+	for _, e := range entries {
+		cidrs = append(cidrs, e.CIDR)
+	}
+	return cidrs
+}
+
+func readIPsFromFile(filePath string) ([]prefixEntry, []prefixEntry, error) {
+	file, err := openInput(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	format := opts.format
+	if format == "" {
+		format = detectFormat(filePath)
+	}
+	entries, err := parseInput(file, format)
+	if err != nil {
+		return nil, nil, err
+	}
+	if opts.verifyDNS {
+		entries = resolveHostnames(entries)
+	}
+
+	ipv4Index := make(map[string]int)
+	ipv6Index := make(map[string]int)
+	var ipv4s, ipv6s []prefixEntry
+	// add appends entry to list unless its CIDR is already there, in which
+	// case -dedupe-strategy decides between the entries.
+	add := func(list *[]prefixEntry, index map[string]int, entry prefixEntry) error {
+		i, exists := index[entry.CIDR]
+		switch {
+		case !exists:
+			index[entry.CIDR] = len(*list)
+			*list = append(*list, entry)
+		case opts.dedupeStrategy == "last":
+			(*list)[i] = entry
+		case opts.dedupeStrategy == "error":
+			return fmt.Errorf("duplicate CIDR %s", entry.CIDR)
+		}
+		return nil
+	}
+
+	for _, entry := range entries {
+		ip := strings.TrimSpace(entry.CIDR)
+		if opts.idempotent {
+			ip = normalizeCIDR(ip)
+		}
+		if ip != "" {
+			entry.CIDR = ip
+			entry.Description = entryDescription(entry.Description)
+			if err := checkPrefixLength(ip); err != nil {
+				if opts.strict {
+					return nil, nil, err
+				}
+				log.Printf("Warning: skipping %v", err)
+				continue
+			}
+			if isIPv4(ip) {
+				if err := add(&ipv4s, ipv4Index, entry); err != nil {
+					return nil, nil, err
+				}
+			} else if isIPv6(ip) {
+				if err := add(&ipv6s, ipv6Index, entry); err != nil {
+					return nil, nil, err
+				}
+			}
+		}
+	}
+
+	return ipv4s, ipv6s, nil
+}
+
+// checkPrefixLength rejects a CIDR more specific than -max-ipv4-prefix-len
+// or -max-ipv6-prefix-len allows.
+func checkPrefixLength(cidr string) error {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return nil
+	}
+	maxLen := opts.maxIPv4PrefixLen
+	if prefix.Addr().Is6() {
+		maxLen = opts.maxIPv6PrefixLen
+	}
+	if prefix.Bits() > maxLen {
+		return fmt.Errorf("%s is more specific than /%d", cidr, maxLen)
+	}
+	return nil
+}
+
+// normalizeCIDR returns the canonical form EC2 reports a CIDR in, with the
+// host bits cleared and IPv6 in lower case, so that it compares equal to the
+// live entry. Anything that doesn't parse is returned unchanged.
+func normalizeCIDR(cidr string) string {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return cidr
+	}
+	return prefix.Masked().String()
+}
+
+// entryDescription applies -description and -entry-description-prefix to a
+// description read from the file.
+func entryDescription(description string) string {
+	description = strings.TrimSpace(description)
+	if description == "" {
+		description = opts.description
+	}
+	return opts.descriptionPrefix + description
+}
+
+// detectFormat picks the input format from the file extension, ignoring a
+// trailing .gz. Unknown extensions are read as plain text.
+func detectFormat(filePath string) string {
+	switch strings.ToLower(filepath.Ext(strings.TrimSuffix(inputPath(filePath), ".gz"))) {
+	case ".json":
+		return "json"
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".csv":
+		return "csv"
+	default:
+		return "text"
+	}
+}
+
+// parseInput extracts the raw entries from r. Values are classified and
+// deduplicated by the caller.
+func parseInput(r io.Reader, format string) ([]prefixEntry, error) {
+	switch format {
+	case "text":
+		return parseText(r)
+	case "json":
+		var entries []prefixEntry
+		if err := json.NewDecoder(r).Decode(&entries); err != nil {
+			return nil, fmt.Errorf("invalid JSON input: %w", err)
+		}
+		return entries, nil
+	case "yaml":
+		var entries []prefixEntry
+		if err := yaml.NewDecoder(r).Decode(&entries); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("invalid YAML input: %w", err)
+		}
+		return entries, nil
+	case "csv":
+		return parseCSV(r)
+	case "netflow":
+		return parseNetflow(r, opts.netflowColumn)
+	default:
+		return nil, fmt.Errorf("unknown input format: %s", format)
+	}
+}
+
+// parseText reads one CIDR per line. Text after a # is the entry's
+// description. -trim-prefix is stripped from the start of each line, and
+// everything from the first -trim-suffix on is stripped from the end. The
+// rest is split into fields by -field-separator, and the CIDR is the field
+// at -cidr-field-index. -filter-regex and -exclude-regex are matched against
+// the whole line first. Only the lines between the -after-line and
+// -before-line markers, when given, are read, and with -section only the
+// lines of the named sections.
+func parseText(r io.Reader) ([]prefixEntry, error) {
+	var entries []prefixEntry
+	inRange := opts.afterLine == ""
+	inSection := len(opts.sections) == 0
+	found := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !inRange {
+			inRange = strings.TrimSpace(line) == opts.afterLine
+			continue
+		}
+		if opts.beforeLine != "" && strings.TrimSpace(line) == opts.beforeLine {
+			break
+		}
+		if len(opts.sections) > 0 {
+			if name, ok := sectionHeader(line); ok {
+				inSection = slices.Contains(opts.sections, name)
+				found[name] = true
+				continue
+			}
+			if !inSection {
+				continue
+			}
+		}
+		if opts.filterRegex != nil && !opts.filterRegex.MatchString(line) {
+			continue
+		}
+		if opts.excludeRegex != nil && opts.excludeRegex.MatchString(line) {
+			continue
+		}
+		cidr, comment, _ := strings.Cut(line, "#")
+		cidr = strings.TrimPrefix(strings.TrimSpace(cidr), opts.trimPrefix)
+		if opts.trimSuffix != "" {
+			cidr, _, _ = strings.Cut(cidr, opts.trimSuffix)
+		}
+		cidr = textField(cidr)
+		entries = append(entries, prefixEntry{CIDR: cidr, Description: comment})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !inRange {
+		log.Printf("Warning: -after-line marker %q not found", opts.afterLine)
+	}
+	for _, name := range opts.sections {
+		if !found[name] {
+			log.Printf("Warning: section %q not found", name)
+		}
+	}
+	return entries, nil
+}
+
+// sectionFlags collects repeated -section flags.
+type sectionFlags []string
+
+func (s *sectionFlags) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *sectionFlags) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// sectionHeader returns the name of the section a "## name" or "[name]"
+// line starts.
+func sectionHeader(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	switch {
+	case strings.HasPrefix(line, "##"):
+		return strings.TrimSpace(strings.TrimLeft(line, "#")), true
+	case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+		return strings.TrimSpace(line[1 : len(line)-1]), true
+	}
+	return "", false
+}
+
+// textField returns the -cidr-field-index field of line, or "" when the line
+// has too few fields.
+func textField(line string) string {
+	var fields []string
+	if opts.fieldSep == "" {
+		fields = strings.Fields(line)
+	} else {
+		fields = strings.Split(line, opts.fieldSep)
+	}
+	if opts.cidrField >= len(fields) {
+		return ""
+	}
+	return strings.TrimSpace(fields[opts.cidrField])
+}
+
+// parseCSV reads the column headed "cidr", or the first column when there
+// is no such header. A column headed "description" supplies descriptions.
+func parseCSV(r io.Reader) ([]prefixEntry, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV input: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	column, descriptionColumn := 0, -1
+	hasHeader := false
+	for i, field := range records[0] {
+		switch strings.ToLower(strings.TrimSpace(field)) {
+		case "cidr":
+			column = i
+			hasHeader = true
+		case "description":
+			descriptionColumn = i
+		}
+	}
+	if !hasHeader {
+		descriptionColumn = -1
+	} else {
+		records = records[1:]
+	}
+
+	var entries []prefixEntry
+	for _, record := range records {
+		if column >= len(record) {
+			continue
+		}
+		entry := prefixEntry{CIDR: record[column]}
+		if descriptionColumn >= 0 && descriptionColumn < len(record) {
+			entry.Description = record[descriptionColumn]
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// parseNetflow reads the IP address column of a CSV or TSV flow export and
+// turns each address into a /32 or /128 CIDR. The first line must be a
+// header naming the column.
+func parseNetflow(r io.Reader, column string) ([]prefixEntry, error) {
+	br := bufio.NewReader(r)
+	header, err := br.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	reader := csv.NewReader(io.MultiReader(strings.NewReader(header), br))
+	if strings.Contains(header, "\t") {
+		reader.Comma = '\t'
+	}
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid netflow input: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	index := slices.IndexFunc(records[0], func(field string) bool {
+		return strings.EqualFold(strings.TrimSpace(field), column)
+	})
+	if index < 0 {
+		return nil, fmt.Errorf("netflow input has no %s column", column)
+	}
+
+	var entries []prefixEntry
+	for _, record := range records[1:] {
+		if index >= len(record) {
+			continue
+		}
+		value := strings.TrimSpace(record[index])
+		if addr, err := netip.ParseAddr(value); err == nil {
+			addr = addr.Unmap()
+			value = netip.PrefixFrom(addr, addr.BitLen()).String()
+		}
+		entries = append(entries, prefixEntry{CIDR: value})
+	}
+	return entries, nil
+}
+
+func isIPv4(ip string) bool {
+	_, _, err := net.ParseCIDR(ip)
+	return err == nil && strings.Contains(ip, ".")
+}
+
+func isIPv6(ip string) bool {
+	_, _, err := net.ParseCIDR(ip)
+	return err == nil && strings.Contains(ip, ":")
+}
+
+// openInput opens the IP file, or downloads it when the path is an http(s)
+// URL, s3:// URI or ssm:// parameter, transparently decompressing it when
+// the path ends in .gz. Local files are opened and streamed without a stat,
+// so a named pipe such as the /dev/fd path of a process substitution works
+// like a file.
+func openInput(filePath string) (io.ReadCloser, error) {
+	var file io.ReadCloser
+	var err error
+	if isURL(filePath) {
+		file, err = fetchURL(filePath)
+	} else if isS3URI(filePath) {
+		file, err = fetchS3Object(filePath)
+	} else if isSSMURI(filePath) {
+		file, err = fetchSSMParameter(filePath)
+	} else {
+		file, err = os.Open(filePath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(inputPath(filePath), ".gz") {
+		return file, nil
+	}
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return gzipReadCloser{gz, file}, nil
+}
+
+// isPipe reports whether filePath is a named pipe, which can be read only
+// once. Stat does not open the pipe, so it does not block.
+func isPipe(filePath string) bool {
+	info, err := os.Stat(filePath)
+	return err == nil && info.Mode()&os.ModeNamedPipe != 0
+}
+
+// gzipReadCloser closes both the gzip stream and the source underneath it.
+type gzipReadCloser struct {
+	*gzip.Reader
+	source io.Closer
+}
+
+func (g gzipReadCloser) Close() error {
+	g.Reader.Close()
+	return g.source.Close()
+}
+
+// isRemoteSource reports whether filePath names a URL, S3 object or SSM
+// parameter rather than a local file.
+func isRemoteSource(filePath string) bool {
+	return isURL(filePath) || isS3URI(filePath) || isSSMURI(filePath)
+}
+
+func isURL(filePath string) bool {
+	return strings.HasPrefix(filePath, "http://") || strings.HasPrefix(filePath, "https://")
+}
+
+// inputPath returns the part of filePath that names the file, dropping the
+// scheme, host and query of a URL.
+func inputPath(filePath string) string {
+	if isURL(filePath) {
+		if u, err := url.Parse(filePath); err == nil {
+			return u.Path
+		}
+	}
+	return filePath
+}
+
+// fetchURL downloads an IP file over HTTP(S).
+func fetchURL(rawURL string) (io.ReadCloser, error) {
+	resp, err := newHTTPClient().Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to fetch %s: %s", rawURL, resp.Status)
+	}
+	return resp.Body, nil
+}
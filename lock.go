@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// dynamoLock is a lock held as an item in a DynamoDB table whose partition
+// key is the string attribute LockID. The item records its owner and an
+// ExpiresAt epoch time, after which another run may take the lock over;
+// enabling DynamoDB TTL on ExpiresAt cleans up locks left by crashed runs.
+type dynamoLock struct {
+	client *dynamodb.Client
+	table  string
+	id     string
+	owner  string
+}
+
+// acquireLock takes the lock named id in table for ttl, failing at once if
+// another run holds an unexpired lock.
+func acquireLock(client *dynamodb.Client, table, id string, ttl time.Duration) (*dynamoLock, error) {
+	lock := &dynamoLock{client: client, table: table, id: id, owner: lockOwner()}
+	now := time.Now()
+	putInput := &dynamodb.PutItemInput{
+		TableName: aws.String(table),
+		Item: map[string]ddbtypes.AttributeValue{
+			"LockID":    &ddbtypes.AttributeValueMemberS{Value: id},
+			"Owner":     &ddbtypes.AttributeValueMemberS{Value: lock.owner},
+			"ExpiresAt": &ddbtypes.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(ttl).Unix(), 10)},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(LockID) OR ExpiresAt < :now"),
+		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+			":now": &ddbtypes.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+		},
+	}
+	if _, err := client.PutItem(context.TODO(), putInput); err != nil {
+		var held *ddbtypes.ConditionalCheckFailedException
+		if errors.As(err, &held) {
+			return nil, fmt.Errorf("lock %s in table %s is held by another run", id, table)
+		}
+		return nil, fmt.Errorf("failed to acquire lock: %w", err)
+	}
+	log.Printf("Acquired lock %s in table %s", id, table)
+	return lock, nil
+}
+
+// release deletes the lock if this run still owns it. Owner is a DynamoDB
+// reserved word, so the condition refers to it by a placeholder. A lock
+// that cannot be released blocks other runs until -lock-ttl passes, so the
+// failure is returned to fail the run.
+func (l *dynamoLock) release() error {
+	deleteInput := &dynamodb.DeleteItemInput{
+		TableName: aws.String(l.table),
+		Key: map[string]ddbtypes.AttributeValue{
+			"LockID": &ddbtypes.AttributeValueMemberS{Value: l.id},
+		},
+		ConditionExpression:      aws.String("#owner = :owner"),
+		ExpressionAttributeNames: map[string]string{"#owner": "Owner"},
+		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+			":owner": &ddbtypes.AttributeValueMemberS{Value: l.owner},
+		},
+	}
+	if _, err := l.client.DeleteItem(context.TODO(), deleteInput); err != nil {
+		return fmt.Errorf("failed to release lock %s (it expires after -lock-ttl): %w", l.id, err)
+	}
+	log.Printf("Released lock %s", l.id)
+	return nil
+}
+
+// lockOwner identifies this run in the lock item.
+func lockOwner() string {
+	host, _ := os.Hostname()
+	b := make([]byte, 8)
+	rand.Read(b)
+	return fmt.Sprintf("%s/%d/%s", host, os.Getpid(), hex.EncodeToString(b))
+}
@@ -2,111 +2,1150 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"cmp"
 	"context"
+	"crypto/x509"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
-	"net"
 	"os"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"golang.org/x/term"
+	"golang.org/x/time/rate"
+)
+
+// options holds the settings shared by every action.
+type options struct {
+	quiet          bool
+	output         string
+	failFast       bool
+	filterTags     tagFlags
+	retries        int
+	noWait         bool
+	format         string
+	netflowColumn  string
+	trimPrefix     string
+	trimSuffix     string
+	fieldSep       string
+	cidrField      int
+	dedupeStrategy string
+	filterRegex    *regexp.Regexp
+	excludeRegex   *regexp.Regexp
+	afterLine      string
+	beforeLine     string
+	sections       sectionFlags
+
+	skipVersionCheck bool
+	maxIPv4PrefixLen int
+	maxIPv6PrefixLen int
+	color            bool
+	hideTagPattern   *regexp.Regexp
+
+	httpTimeout         time.Duration
+	connectTimeout      time.Duration
+	tlsHandshakeTimeout time.Duration
+	rootCAs             *x509.CertPool
+	headroomPercent     int
+	cacheDir            string
+	description         string
+	descriptionPrefix   string
+	maxDescriptionLen   int
+	strict              bool
+	emptyListBehavior   string
+	ipVersionStrategy   string
+	addressFamily       string
+
+	deleteEmptyAfterUpdate bool
+	idempotent             bool
+	compressOutput         bool
+	autoCreateTags         bool
+	skipIfExists           bool
+	failIfExists           bool
+	createIfNotExists      bool
+	failIfNotExists        bool
+
+	snapshotBeforeUpdate  bool
+	snapshotDir           string
+	snapshotRetentionDays int
+
+	cloudwatchNamespace string
+	cloudwatchAlarm     bool
+	alarmMinEntries     int
+	alarmMaxEntries     int
+	snsTopicARN         string
+	webhookURL          string
+	webhookFormat       string
+	verbose             bool
+	maxResults          int
+	waitTimeout         time.Duration
+	restoreWaitTimeout  time.Duration
+	entryTTL            time.Duration
+	rollbackOnError     bool
+	changeLogFile       string
+	noAutoExpand        bool
+	requireVersion      int64
+	costPerEntryHour    float64
+	verifyDNS           bool
+}
+
+var opts options
+
+// Build information, set with -ldflags "-X main.version=... -X main.commit=...
+// -X main.buildDate=..." (see the Makefile).
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
 )
 
 func main() {
-	action := flag.String("action", "create", "Action to perform: create or update")
+	var tags tagFlags
+	action := flag.String("action", "create", "Action to perform: create, update, list, describe, discover, audit, reconcile, events, list-versions, compare-versions, wait, expire, purge, copy-tags, check-drift, health, check-permissions or test-credentials")
 	prefixListName := flag.String("name", "", "Name of the prefix list")
-	filePath := flag.String("file", "", "Path to the file containing IPs")
+	nameTemplate := flag.String("prefix-list-name-template", "", "Go template rendering the prefix list name from -var values, e.g. '{{.Environment}}-allowlist'")
+	nameVars := templateVars{}
+	flag.Var(nameVars, "var", "Key=Value variable for -prefix-list-name-template (repeatable)")
+	filePath := flag.String("file", "", "Path, http(s) URL, s3:// URI or ssm:// parameter of the file containing IPs")
+	ssmEndpoint := flag.String("aws-endpoint-url-ssm", "", "Custom endpoint for the SSM client that reads ssm:// files, e.g. for LocalStack")
+	flag.StringVar(&opts.description, "description", "", "Description for entries that have none in the IP file")
+	flag.IntVar(&opts.maxDescriptionLen, "max-description-length", maxDescriptionLength, "Truncate entry descriptions longer than this, ending them with ...")
+	flag.StringVar(&opts.descriptionPrefix, "entry-description-prefix", "", "Prefix added to every entry description; on update, only entries with this prefix are removed")
+	flag.StringVar(&opts.format, "format", "", "Input file format: text, json, yaml, csv or netflow (detected from the file extension by default)")
+	flag.StringVar(&opts.trimPrefix, "trim-prefix", "", "For text input, strip this literal prefix from each line, e.g. \"ALLOW \"")
+	flag.StringVar(&opts.trimSuffix, "trim-suffix", "", "For text input, strip each line from the first occurrence of this string, e.g. \";\"")
+	flag.StringVar(&opts.fieldSep, "field-separator", "", "For text input, the separator between the fields of a line (default: any whitespace)")
+	flag.IntVar(&opts.cidrField, "cidr-field-index", 0, "For text input, the 0-based index of the field holding the CIDR")
+	flag.StringVar(&opts.dedupeStrategy, "dedupe-strategy", "first", "Which entry to keep when a CIDR appears more than once: first, last, or error to fail")
+	filterRegex := flag.String("filter-regex", "", "For text input, only read lines matching this regular expression")
+	excludeRegex := flag.String("exclude-regex", "", "For text input, skip lines matching this regular expression")
+	flag.StringVar(&opts.afterLine, "after-line", "", "For text input, only read lines after the line equal to this marker")
+	flag.StringVar(&opts.beforeLine, "before-line", "", "For text input, stop reading at the line equal to this marker")
+	flag.Var(&opts.sections, "section", "For text input, only read the section with this \"## name\" or \"[name]\" header (repeatable)")
+	flag.StringVar(&opts.netflowColumn, "netflow-column", "src_ip", "For -format netflow, the column holding the IP addresses, e.g. src_ip or dst_ip")
+	flag.DurationVar(&opts.httpTimeout, "http-timeout", 30*time.Second, "Total time allowed to download an http(s) -file")
+	flag.DurationVar(&opts.connectTimeout, "connect-timeout", 10*time.Second, "Time allowed to connect when downloading an http(s) -file")
+	flag.DurationVar(&opts.tlsHandshakeTimeout, "tls-handshake-timeout", 10*time.Second, "Time allowed for the TLS handshake when downloading an https -file")
+	caBundle := flag.String("ca-bundle", "", "PEM file of CA certificates to trust for AWS API calls and https -file downloads")
+	proxy := flag.String("proxy", "", "HTTP proxy URL for AWS API calls and http(s) -file downloads")
+	noProxy := flag.String("no-proxy", "", "Comma-separated hosts that bypass -proxy")
+	prefixListID := flag.String("prefix-list-id", "", "ID of the prefix list to update, skipping the lookup by name")
+	flag.BoolVar(&opts.quiet, "quiet", false, "Suppress progress output")
+	hideTagPattern := flag.String("hide-sensitive-tag-pattern", "", "Print *** in place of tag values whose key or value matches this regular expression")
+	flag.IntVar(&opts.maxResults, "max-results", 0, "Show at most this many prefix lists with list, or entries with describe (0 for all)")
+	flag.StringVar(&opts.output, "output", "text", "Output format: text, json, jsonlines or table")
+	flag.BoolVar(&opts.failFast, "fail-fast", true, "Abort on the first failed batch")
+	noFailFast := flag.Bool("no-fail-fast", false, "Attempt every batch and report all errors at the end")
+	flag.Var(&tags, "tag", "Tag as Key=Value, applied to created lists and matched by discover (repeatable)")
+	tagsFile := flag.String("tags-from-file", "", "JSON file of tags to merge with -tag, as {\"Key\":\"Value\"} or [{\"Key\":\"k\",\"Value\":\"v\"}]")
+	namePrefix := flag.String("name-prefix", "", "Audit prefix lists whose name starts with this prefix")
+	auditDir := flag.String("audit-dir", "", "Directory holding the expected <prefix-list-name>.txt files")
+	flag.DurationVar(&opts.waitTimeout, "wait-timeout", 15*time.Minute, "Give up waiting for a prefix list to finish a create or modify after this long")
+	flag.DurationVar(&opts.restoreWaitTimeout, "restore-wait-timeout", time.Hour, "Give up waiting for a prefix list to finish restoring a version after this long")
+	flag.IntVar(&opts.retries, "retries", 3, "Maximum attempts for each AWS API call, including retries of throttled requests")
+	retryMode := flag.String("aws-retry-mode", "", "AWS SDK retry mode: standard or adaptive (default: AWS_RETRY_MODE or the shared config, else standard)")
+	flag.BoolVar(&opts.noWait, "no-wait", false, "Do not wait for the prefix list to settle after each modification")
+	flag.BoolVar(&opts.skipVersionCheck, "skip-version-check", false, "Use the version the previous batch produced instead of describing the list before each batch")
+	simulateErrorOnBatch := flag.Int64("simulate-error-on-batch", 0, "For testing: fail every attempt of the Nth create or modify batch with a synthetic throttling error (0 to disable)")
+	rateLimit := flag.Float64("rate-limit", 0, "Maximum AWS API calls per second (0 for no limit)")
+	limitVersions := flag.Int64("limit-versions", 0, "Show only this many of the most recent versions with list-versions (0 for all)")
+	versionA := flag.Int64("version-a", 0, "Older version to compare with compare-versions")
+	versionB := flag.Int64("version-b", 0, "Newer version to compare with compare-versions")
+	showDiff := flag.Bool("show-diff", false, "Show the entries added and removed by each version in events")
+	accessKeyID := flag.String("aws-access-key-id", "", "AWS access key ID, overriding the default credential chain")
+	secretAccessKey := flag.String("aws-secret-access-key", "", "AWS secret access key for -aws-access-key-id")
+	sessionToken := flag.String("aws-session-token", "", "Session token for temporary -aws-access-key-id credentials")
+	assumeRole := flag.String("assume-role", "", "ARN of an IAM role to assume for all AWS calls")
+	webIdentityTokenFile := flag.String("web-identity-token-file", "", "Web identity token used to assume -assume-role (defaults to $AWS_WEB_IDENTITY_TOKEN_FILE)")
+	roleSessionName := flag.String("role-session-name", "aws-prefix-list", "Session name used when assuming -assume-role")
+	flag.IntVar(&opts.headroomPercent, "max-entries-headroom-percent", 0, "Extra MaxEntries capacity to reserve when creating, as a percentage of the entry count")
+	flag.StringVar(&opts.cacheDir, "local-cache-dir", "", "Cache prefix list entries in this directory, keyed by list ID and version")
+	warnOnEmpty := flag.Bool("warn-on-empty", false, "Warn when the IP file contains no CIDRs (an error with -strict)")
+	flag.IntVar(&opts.maxIPv4PrefixLen, "max-ipv4-prefix-len", 32, "Skip IPv4 CIDRs with a longer prefix than this (an error with -strict)")
+	flag.IntVar(&opts.maxIPv6PrefixLen, "max-ipv6-prefix-len", 128, "Skip IPv6 CIDRs with a longer prefix than this (an error with -strict)")
+	flag.BoolVar(&opts.strict, "strict", false, "Turn input warnings into errors")
+	flag.StringVar(&opts.emptyListBehavior, "empty-list-behavior", "create", "What to do with a family that has no entries: create, skip or delete")
+	flag.StringVar(&opts.addressFamily, "address-family", "both", "Address families to create or update: ipv4, ipv6 or both")
+	flag.StringVar(&opts.ipVersionStrategy, "ip-version-strategy", "unified-by-family", "How to store the entries: unified-by-family (<name>-ipv4 and <name>-ipv6) or single (one list named <name>)")
+	flag.BoolVar(&opts.deleteEmptyAfterUpdate, "delete-empty-after-update", false, "Delete a prefix list that has no entries left after an update")
+	preFlight := flag.Bool("pre-flight-check", false, "Make one read-only EC2 call to check connectivity and credentials before running the action")
+	flag.BoolVar(&opts.skipIfExists, "skip-if-exists", false, "Leave a list that already exists unchanged on create instead of failing")
+	flag.BoolVar(&opts.failIfExists, "fail-if-exists", false, "Fail create before creating anything if any of its lists already exists")
+	flag.BoolVar(&opts.createIfNotExists, "create-if-not-exists", false, "Create a list that does not exist on update instead of failing")
+	flag.BoolVar(&opts.failIfNotExists, "fail-if-not-exists", false, "Fail update with exit code 4 before updating anything if any of its lists does not exist")
+	flag.BoolVar(&opts.autoCreateTags, "auto-create-tags", false, "Tag created lists with CreatedBy, CreatedAt and CreatedByTool, and updated lists with LastModifiedBy and LastModifiedAt")
+	flag.BoolVar(&opts.idempotent, "idempotent", false, "Make create and update safe to rerun: normalize CIDRs, update lists that already exist and wait for lists to settle")
+	flag.BoolVar(&opts.snapshotBeforeUpdate, "snapshot-before-update", false, "Save the entries of each prefix list to -snapshot-dir before changing them")
+	flag.StringVar(&opts.snapshotDir, "snapshot-dir", "snapshots", "Directory for -snapshot-before-update files")
+	flag.IntVar(&opts.snapshotRetentionDays, "snapshot-retention-days", 0, "Delete snapshots older than this many days (0 keeps them all)")
+	minEntries := flag.Int("min-entries", 0, "For -action health, the fewest entries each prefix list should hold")
+	maxEntries := flag.Int("max-entries", 0, "For -action health, the most entries each prefix list should hold (0 for no limit)")
+	var globalTags tagFlags
+	flag.Var(&globalTags, "global-tag", "With -bulk-file, tag as Key=Value applied to every list; item tags take precedence (repeatable)")
+	noCloudWatch := flag.Bool("no-cloudwatch", false, "Do not publish operation metrics to CloudWatch")
+	flag.StringVar(&opts.cloudwatchNamespace, "cloudwatch-namespace", "AWSPrefixList", "CloudWatch namespace for operation metrics")
+	flag.BoolVar(&opts.cloudwatchAlarm, "cloudwatch-alarm", false, "Create or update a CloudWatch alarm on the entry count of each list created or updated")
+	flag.IntVar(&opts.alarmMinEntries, "alarm-min-entries", 0, "With -cloudwatch-alarm, alarm when the entry count falls below this (0 for no minimum)")
+	flag.IntVar(&opts.alarmMaxEntries, "alarm-max-entries", 0, "With -cloudwatch-alarm, alarm when the entry count exceeds this (0 for no maximum)")
+	flag.StringVar(&opts.webhookURL, "webhook-url", "", "POST a message describing each create, update or delete to this webhook URL")
+	flag.StringVar(&opts.webhookFormat, "webhook-format", "generic", "Webhook payload format: generic, slack or teams")
+	flag.StringVar(&opts.snsTopicARN, "sns-topic-arn", "", "Publish a JSON message describing each create, update or delete to this SNS topic")
+	flag.BoolVar(&opts.verbose, "verbose", false, "With -action describe, show the version each entry was added in")
+	lockBeforeUpdate := flag.Bool("lock-before-update", false, "Hold a DynamoDB lock in -lock-table while creating or updating prefix lists")
+	lockTable := flag.String("lock-table", "", "DynamoDB table for -lock-before-update, with a string partition key named LockID")
+	lockTTL := flag.Duration("lock-ttl", 5*time.Minute, "How long a -lock-before-update lock lasts before another run may take it over")
+	flag.DurationVar(&opts.entryTTL, "entry-ttl", 0, "Mark entries added by create or update to expire after this long, for -action expire to remove")
+	flag.BoolVar(&opts.rollbackOnError, "rollback-on-error", false, "If an update fails part way through, restore the version the list had before it")
+	flag.StringVar(&opts.changeLogFile, "output-change-log", "", "Append a line for every entry added or removed to this file")
+	flag.BoolVar(&opts.noAutoExpand, "no-auto-expand-max-entries", false, "Fail an update that needs more than the list's MaxEntries instead of raising it")
+	flag.Int64Var(&opts.requireVersion, "require-version", 0, "Fail an update unless the prefix list is at this version")
+	flag.BoolVar(&opts.verifyDNS, "verify-dns", false, "Resolve hostnames in the IP file to /32 and /128 entries")
+	exportFormat := flag.String("export-format", "", "With describe, print the lists as commands instead: aws-cli")
+	filterState := flag.String("filter-state", "", "Only list prefix lists in this state, e.g. active or modify-in-progress")
+	sortBy := flag.String("sort-by", "", "Sort list output by name, version (newest first), state or entry-count (largest first)")
+	groupByTag := flag.String("group-by-tag", "", "With -action list, group the prefix lists by the value of this tag key")
+	copyTarget := flag.String("target", "", "With -action copy-tags, the name of the prefix lists to copy the tags of -name to")
+	overwriteTags := flag.Bool("overwrite-tags", false, "With -action copy-tags, replace tags the target already has instead of skipping them")
+	s3Bucket := flag.String("s3-source-bucket", "", "With -action check-drift, the S3 bucket holding the expected IP files")
+	s3Prefix := flag.String("s3-source-prefix", "", "With -action check-drift, the key prefix of the expected IP files")
+	printCfg := flag.Bool("print-config", false, "Print the effective configuration as YAML to stderr before running, with secrets masked")
+	envFile := flag.String("env-file", "", "Load KEY=VALUE environment variables from this file; variables already set take priority")
+	metricsFile := flag.String("output-metrics-file", "", "Write Prometheus metrics for every create, update and delete of the run to this file, e.g. for the node_exporter textfile collector")
+	summaryFile := flag.String("output-summary-file", "", "Write a JSON array describing every create, update and delete of the run to this file")
+	flag.BoolVar(&opts.compressOutput, "compress-output", false, "Gzip files written by the tool and append .gz to their names")
+	bulkFile := flag.String("bulk-file", "", "YAML or JSON file listing prefix lists to create or update, as {name, file, action, tags} objects")
+	entriesFile := flag.String("output-entries-file", "", "After create or update, write the IPv4 entries sent to AWS to this file")
+	entriesFileIPv6 := flag.String("output-entries-file-ipv6", "", "After create or update, write the IPv6 entries sent to AWS to this file")
+	regionList := flag.String("regions", "", "Comma-separated regions to run the action in, each in its own process")
+	parallelRegions := flag.Int("parallel-regions", 0, "With -regions, how many regions to run at once (default: all)")
+	schedule := flag.String("schedule", "", "Cron expression to run the action on repeatedly, e.g. \"0 * * * *\"")
+	runOnceOnStart := flag.Bool("run-once-on-start", false, "With -schedule, also run the action immediately")
+	interactive := flag.Bool("interactive", false, "Prompt for missing required flags when running in a terminal")
+	accountID := flag.String("account-id", "", "Refuse to run unless the credentials belong to this AWS account")
+	dryRun := flag.Bool("dry-run", false, "Show what reconcile would change without applying it")
+	outputPlanFile := flag.String("output-plan-file", "", "With -action update, write the planned changes to this JSON file instead of applying them")
+	costEstimate := flag.Bool("output-cost-estimate", false, "With -action create or update, print the projected monthly entry-hours and cost of the lists instead of changing them")
+	flag.Float64Var(&opts.costPerEntryHour, "cost-per-entry-hour", 0, "USD per prefix list entry-hour for -output-cost-estimate")
+	applyPlan := flag.String("apply-plan-file", "", "With -action update, apply the changes in a plan written by -output-plan-file")
+	flag.Var(&opts.filterTags, "filter-tag", "Only consider prefix lists with this Key=Value tag (repeatable)")
+	colorOutput := flag.Bool("color", false, "Color diff and progress output (default: only when stdout is a terminal)")
+	noColor := flag.Bool("no-color", false, "Never color output")
+	generatePolicy := flag.Bool("generate-policy", false, "Print an IAM policy document with the permissions the tool needs, then exit")
+	policyResource := flag.String("policy-resource", "*", "Resource ARN for -generate-policy and check-permissions")
+	showVersion := flag.Bool("version", false, "Print the version, commit and build date, then exit")
 	flag.Parse()
+	if *showVersion {
+		fmt.Printf("aws-prefix-list %s (commit %s, built %s)\n", version, commit, buildDate)
+		return
+	}
+	if *generatePolicy {
+		printPolicy(*policyResource)
+		return
+	}
+	if *envFile != "" {
+		if err := loadEnvFile(*envFile); err != nil {
+			log.Fatalf("Failed to load env file: %v", err)
+		}
+	}
+	if *noFailFast {
+		opts.failFast = false
+	}
+	opts.filterRegex = compileFlagRegexp("filter-regex", *filterRegex)
+	opts.excludeRegex = compileFlagRegexp("exclude-regex", *excludeRegex)
+	opts.hideTagPattern = compileFlagRegexp("hide-sensitive-tag-pattern", *hideTagPattern)
+	// Both the AWS SDK and the download client read the proxy settings from
+	// the environment on their first request, so set them before any.
+	if *proxy != "" {
+		os.Setenv("HTTP_PROXY", *proxy)
+		os.Setenv("HTTPS_PROXY", *proxy)
+	}
+	if *noProxy != "" {
+		os.Setenv("NO_PROXY", *noProxy)
+	}
+	opts.color = term.IsTerminal(int(os.Stdout.Fd()))
+	if isFlagSet("color") {
+		opts.color = *colorOutput
+	}
+	if *noColor {
+		opts.color = false
+	}
+
+	if *prefixListID != "" && *action == "create" {
+		log.Fatal("-prefix-list-id is not supported with the create action")
+	}
+	if opts.failIfNotExists && opts.createIfNotExists {
+		log.Fatal("-fail-if-not-exists and -create-if-not-exists are mutually exclusive")
+	}
+	if *prefixListID != "" && opts.createIfNotExists {
+		log.Fatal("-create-if-not-exists needs -name; a list cannot be created from an ID")
+	}
+	if opts.output != "text" && opts.output != "json" && opts.output != "jsonlines" && opts.output != "table" {
+		log.Fatalf("Unknown output format: %s", opts.output)
+	}
+	switch opts.emptyListBehavior {
+	case "create", "skip", "delete":
+	default:
+		log.Fatalf("Unknown empty list behavior: %s", opts.emptyListBehavior)
+	}
+	if opts.maxIPv4PrefixLen < 0 || opts.maxIPv4PrefixLen > 32 {
+		log.Fatal("-max-ipv4-prefix-len must be between 0 and 32")
+	}
+	if opts.maxIPv6PrefixLen < 0 || opts.maxIPv6PrefixLen > 128 {
+		log.Fatal("-max-ipv6-prefix-len must be between 0 and 128")
+	}
+	if *filterState != "" && !slices.Contains(types.PrefixListState("").Values(), types.PrefixListState(*filterState)) {
+		log.Fatalf("Unknown -filter-state: %s", *filterState)
+	}
+	if *exportFormat != "" && *exportFormat != "aws-cli" {
+		log.Fatalf("Unknown -export-format: %s", *exportFormat)
+	}
+	switch *sortBy {
+	case "", "name", "version", "state", "entry-count":
+	default:
+		log.Fatalf("Unknown -sort-by: %s", *sortBy)
+	}
+	switch opts.dedupeStrategy {
+	case "first", "last", "error":
+	default:
+		log.Fatalf("Unknown -dedupe-strategy: %s", opts.dedupeStrategy)
+	}
+	if opts.cidrField < 0 {
+		log.Fatal("-cidr-field-index cannot be negative")
+	}
+	if opts.alarmMinEntries < 0 || opts.alarmMaxEntries < 0 {
+		log.Fatal("-alarm-min-entries and -alarm-max-entries must not be negative")
+	}
+	if opts.cloudwatchAlarm {
+		if *noCloudWatch {
+			log.Fatal("-cloudwatch-alarm cannot be used with -no-cloudwatch")
+		}
+		if opts.alarmMinEntries == 0 && opts.alarmMaxEntries == 0 {
+			log.Fatal("-cloudwatch-alarm requires -alarm-min-entries or -alarm-max-entries")
+		}
+		if opts.alarmMaxEntries > 0 && opts.alarmMinEntries > opts.alarmMaxEntries {
+			log.Fatal("-alarm-min-entries must not be greater than -alarm-max-entries")
+		}
+	} else if opts.alarmMinEntries > 0 || opts.alarmMaxEntries > 0 {
+		log.Fatal("-alarm-min-entries and -alarm-max-entries require -cloudwatch-alarm")
+	}
+	switch opts.webhookFormat {
+	case "generic", "slack", "teams":
+	default:
+		log.Fatalf("Unknown -webhook-format: %s", opts.webhookFormat)
+	}
+	if opts.maxResults < 0 {
+		log.Fatal("-max-results cannot be negative")
+	}
+	if opts.maxDescriptionLen < 1 || opts.maxDescriptionLen > maxDescriptionLength {
+		log.Fatalf("-max-description-length must be between 1 and %d", maxDescriptionLength)
+	}
+	if *simulateErrorOnBatch < 0 {
+		log.Fatal("-simulate-error-on-batch cannot be negative")
+	}
+	if opts.requireVersion < 0 {
+		log.Fatal("-require-version cannot be negative")
+	}
+	if opts.snapshotRetentionDays < 0 {
+		log.Fatal("-snapshot-retention-days cannot be negative")
+	}
+	if opts.idempotent && opts.noWait {
+		log.Fatal("-idempotent cannot be used with -no-wait")
+	}
+	if opts.skipIfExists && opts.idempotent {
+		log.Fatal("-skip-if-exists and -idempotent are mutually exclusive")
+	}
+	if opts.failIfExists && (opts.skipIfExists || opts.idempotent) {
+		log.Fatal("-fail-if-exists cannot be used with -skip-if-exists or -idempotent")
+	}
+	switch opts.addressFamily {
+	case "ipv4", "ipv6", "both":
+	default:
+		log.Fatalf("Unknown address family: %s", opts.addressFamily)
+	}
+	switch opts.ipVersionStrategy {
+	case "unified-by-family", "single":
+	default:
+		log.Fatalf("Unknown IP version strategy: %s", opts.ipVersionStrategy)
+	}
+	switch opts.format {
+	case "", "text", "json", "yaml", "csv", "netflow":
+	default:
+		log.Fatalf("Unknown input format: %s", opts.format)
+	}
+
+	if *nameTemplate != "" {
+		if *prefixListName != "" {
+			log.Fatal("-name and -prefix-list-name-template are mutually exclusive")
+		}
+		name, err := renderName(*nameTemplate, nameVars)
+		if err != nil {
+			log.Fatal(err)
+		}
+		*prefixListName = name
+	} else if len(nameVars) > 0 {
+		log.Fatal("-var needs -prefix-list-name-template")
+	}
+
+	var bulkItems []bulkItem
+	if *bulkFile != "" {
+		var err error
+		if bulkItems, err = loadBulkFile(*bulkFile); err != nil {
+			log.Fatalf("Failed to read bulk file: %v", err)
+		}
+		*action = "bulk"
+	}
+
+	if *interactive && term.IsTerminal(int(os.Stdin.Fd())) {
+		stdin := bufio.NewReader(os.Stdin)
+		switch *action {
+		case "create", "update":
+			if *applyPlan != "" {
+				break
+			}
+			if *prefixListID == "" {
+				promptIfMissing(stdin, prefixListName, "prefix list name")
+			}
+			promptIfMissing(stdin, filePath, "path to the IP file")
+		case "describe", "events", "wait":
+			if *prefixListID == "" {
+				promptIfMissing(stdin, prefixListName, "prefix list name")
+			}
+		case "audit", "reconcile":
+			promptIfMissing(stdin, namePrefix, "prefix list name prefix")
+			promptIfMissing(stdin, auditDir, "audit directory")
+		}
+	}
+
 	log.Printf("Action: %s\n", *action)
 	log.Printf("Prefix list name: %s\n", *prefixListName)
 	log.Printf("File path: %s\n", *filePath)
 
-	if *prefixListName == "" || *filePath == "" {
-		log.Fatal("Prefix list name and file path are required")
+	if *tagsFile != "" {
+		fileTags, err := loadTagsFile(*tagsFile)
+		if err != nil {
+			log.Fatalf("Failed to read tags file: %v", err)
+		}
+		tags = mergeTags(fileTags, tags)
 	}
 
-	ipv4s, ipv6s, err := readIPsFromFile(*filePath)
-	if err != nil {
-		log.Fatalf("Failed to read IPs from file: %v", err)
+	// The lock is named after what the run modifies, so runs against the
+	// same lists exclude each other. A plan is applied without a name or
+	// ID, so it is locked by its path.
+	lockID := cmp.Or(*bulkFile, *applyPlan, *prefixListID, *prefixListName, *namePrefix)
+	if *lockBeforeUpdate {
+		if *lockTable == "" {
+			log.Fatal("-lock-before-update needs -lock-table")
+		}
+		if *lockTTL <= 0 {
+			log.Fatal("-lock-ttl must be positive")
+		}
 	}
 
-	cfg, err := config.LoadDefaultConfig(context.TODO())
-	if err != nil {
-		log.Fatalf("Failed to load AWS config: %v", err)
+	if *outputPlanFile != "" || *applyPlan != "" {
+		if *action != "update" {
+			log.Fatal("-output-plan-file and -apply-plan-file require -action update")
+		}
+		if *outputPlanFile != "" && *applyPlan != "" {
+			log.Fatal("-output-plan-file and -apply-plan-file cannot be used together")
+		}
+	}
+	if *costEstimate {
+		if *action != "create" && *action != "update" {
+			log.Fatal("-output-cost-estimate requires -action create or update")
+		}
+		if *applyPlan != "" || *outputPlanFile != "" {
+			log.Fatal("-output-cost-estimate cannot be used with a plan file")
+		}
+	}
+	if opts.costPerEntryHour < 0 {
+		log.Fatal("-cost-per-entry-hour must not be negative")
+	}
+	if *outputPlanFile != "" && (opts.createIfNotExists || opts.emptyListBehavior == "delete") {
+		log.Fatal("-output-plan-file cannot be used with -create-if-not-exists or -empty-list-behavior delete")
 	}
-
-	svc := ec2.NewFromConfig(cfg)
 
 	switch *action {
-	case "create":
-		createPrefixList(svc, *prefixListName+"-ipv4", "IPv4", ipv4s)
-		createPrefixList(svc, *prefixListName+"-ipv6", "IPv6", ipv6s)
-	case "update":
-		updatePrefixList(svc, *prefixListName+"-ipv4", ipv4s)
-		updatePrefixList(svc, *prefixListName+"-ipv6", ipv6s)
+	case "bulk":
+	case "create", "update":
+		if *applyPlan != "" {
+			break
+		}
+		if *filePath == "" || (*prefixListName == "" && *prefixListID == "") {
+			log.Fatal("Prefix list name and file path are required")
+		}
+	case "discover":
+		if len(tags) == 0 && len(opts.filterTags) == 0 {
+			log.Fatal("At least one -tag is required to discover prefix lists")
+		}
+	case "list", "check-permissions", "test-credentials":
+	case "health":
+		if *minEntries < 0 || *maxEntries < 0 {
+			log.Fatal("-min-entries and -max-entries cannot be negative")
+		}
+		if (*minEntries > 0 || *maxEntries > 0) && *prefixListName == "" && *prefixListID == "" {
+			log.Fatal("-min-entries and -max-entries need a prefix list name or ID")
+		}
+	case "check-drift":
+		if *s3Bucket == "" {
+			log.Fatal("-s3-source-bucket is required")
+		}
+	case "copy-tags":
+		if *prefixListName == "" || *copyTarget == "" {
+			log.Fatal("Source prefix list name and -target are required")
+		}
+	case "describe", "events", "wait", "expire", "purge":
+		if *prefixListName == "" && *prefixListID == "" {
+			log.Fatal("Prefix list name or ID is required")
+		}
+	case "list-versions":
+		if *prefixListName == "" && *prefixListID == "" {
+			log.Fatal("Prefix list name or ID is required")
+		}
+		if *limitVersions < 0 {
+			log.Fatal("-limit-versions cannot be negative")
+		}
+	case "compare-versions":
+		if *prefixListName == "" && *prefixListID == "" {
+			log.Fatal("Prefix list name or ID is required")
+		}
+		if *versionA < 1 || *versionB < 1 {
+			log.Fatal("-version-a and -version-b are required")
+		}
+	case "audit", "reconcile":
+		if *namePrefix == "" || *auditDir == "" {
+			log.Fatal("Name prefix and audit directory are required")
+		}
 	default:
 		log.Fatalf("Unknown action: %s", *action)
 	}
-}
 
-func readIPsFromFile(filePath string) ([]string, []string, error) {
-	file, err := os.Open(filePath)
+	if opts.headroomPercent < 0 {
+		log.Fatal("-max-entries-headroom-percent cannot be negative")
+	}
+	if opts.waitTimeout <= 0 || opts.restoreWaitTimeout <= 0 {
+		log.Fatal("-wait-timeout and -restore-wait-timeout must be positive")
+	}
+	if opts.retries < 1 {
+		log.Fatal("-retries must be at least 1")
+	}
+
+	if *regionList != "" {
+		regions := splitRegions(*regionList)
+		if len(regions) == 0 {
+			log.Fatal("-regions needs at least one region")
+		}
+		if *parallelRegions < 0 {
+			log.Fatal("-parallel-regions cannot be negative")
+		}
+		if *schedule != "" {
+			log.Fatal("-regions cannot be used with -schedule")
+		}
+		if isPipe(*filePath) {
+			log.Fatal("-regions cannot re-read a pipe; -file must be a regular file or URL")
+		}
+		if *interactive {
+			log.Fatal("-regions cannot be used with -interactive")
+		}
+		for _, name := range regionOutputFlags {
+			// -snapshot-dir has a default, so it only matters when used.
+			if name == "snapshot-dir" && !opts.snapshotBeforeUpdate {
+				continue
+			}
+			if path := flag.Lookup(name).Value.String(); path != "" && !strings.Contains(path, "{region}") {
+				log.Fatalf("-%s is written by every region; include {region} in the path", name)
+			}
+		}
+		parallel := len(regions)
+		if *parallelRegions > 0 {
+			parallel = min(*parallelRegions, len(regions))
+		}
+		os.Exit(runRegions(regions, parallel))
+	}
+
+	loadOptions := []func(*config.LoadOptions) error{config.WithRetryMaxAttempts(opts.retries)}
+	if *retryMode != "" {
+		// The Go SDK has no legacy mode; standard replaced it.
+		if *retryMode == "legacy" {
+			log.Print("Warning: -aws-retry-mode legacy is not supported by the AWS SDK for Go v2, using standard")
+			*retryMode = string(aws.RetryModeStandard)
+		}
+		mode, err := aws.ParseRetryMode(*retryMode)
+		if err != nil {
+			log.Fatalf("Invalid -aws-retry-mode: %v", err)
+		}
+		loadOptions = append(loadOptions, config.WithRetryMode(mode))
+	}
+	if (*accessKeyID == "") != (*secretAccessKey == "") {
+		log.Fatal("-aws-access-key-id and -aws-secret-access-key must be given together")
+	}
+	if *accessKeyID != "" {
+		creds := aws.Credentials{
+			AccessKeyID:     *accessKeyID,
+			SecretAccessKey: *secretAccessKey,
+			SessionToken:    *sessionToken,
+			Source:          "CommandLineFlags",
+		}
+		loadOptions = append(loadOptions, config.WithCredentialsProvider(aws.CredentialsProviderFunc(
+			func(context.Context) (aws.Credentials, error) {
+				return creds, nil
+			})))
+	}
+	if *caBundle != "" {
+		pem, err := os.ReadFile(*caBundle)
+		if err != nil {
+			log.Fatalf("Failed to read CA bundle: %v", err)
+		}
+		opts.rootCAs = x509.NewCertPool()
+		if !opts.rootCAs.AppendCertsFromPEM(pem) {
+			log.Fatalf("No certificates found in CA bundle %s", *caBundle)
+		}
+		loadOptions = append(loadOptions, config.WithCustomCABundle(bytes.NewReader(pem)))
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO(), loadOptions...)
 	if err != nil {
-		return nil, nil, err
-	}
-	defer file.Close()
-
-	ipv4Set := make(map[string]struct{})
-	ipv6Set := make(map[string]struct{})
-	var ipv4s, ipv6s []string
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		ip := strings.TrimSpace(scanner.Text())
-		if ip != "" {
-			if isIPv4(ip) {
-				if _, exists := ipv4Set[ip]; !exists {
-					ipv4Set[ip] = struct{}{}
-					ipv4s = append(ipv4s, ip)
+		log.Fatalf("Failed to load AWS config: %v", err)
+	}
+	if *printCfg {
+		printConfig(cfg.Region)
+	}
+	if *assumeRole != "" {
+		cfg.Credentials = assumeRoleProvider(cfg, *assumeRole, *webIdentityTokenFile, *roleSessionName)
+	}
+	cfg.APIOptions = append(cfg.APIOptions, withCallCounter(&apiCalls))
+	if *rateLimit > 0 {
+		cfg.APIOptions = append(cfg.APIOptions, withRateLimit(rate.NewLimiter(rate.Limit(*rateLimit), 1)))
+	}
+	if *simulateErrorOnBatch > 0 {
+		log.Printf("Warning: simulating a throttling error on batch %d", *simulateErrorOnBatch)
+		cfg.APIOptions = append(cfg.APIOptions, withSimulatedError(*simulateErrorOnBatch))
+	}
+
+	if *accountID != "" {
+		if err := verifyAccount(cfg, *accountID); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	svc := ec2.NewFromConfig(cfg)
+	s3Client = s3.NewFromConfig(cfg)
+	ssmClient = ssm.NewFromConfig(cfg, func(o *ssm.Options) {
+		if *ssmEndpoint != "" {
+			o.BaseEndpoint = aws.String(*ssmEndpoint)
+		}
+	})
+	if opts.autoCreateTags {
+		if err := loadOperator(cfg); err != nil {
+			log.Fatalf("-auto-create-tags: %v", err)
+		}
+	} else if opts.changeLogFile != "" {
+		// Without the identity the change log still records the changes.
+		if err := loadOperator(cfg); err != nil {
+			log.Printf("Warning: change log operator unknown: %v", err)
+		}
+	}
+	if !*noCloudWatch {
+		metricsClient = cloudwatch.NewFromConfig(cfg)
+	}
+	if opts.snsTopicARN != "" {
+		notifyClient = sns.NewFromConfig(cfg)
+	}
+	if *preFlight {
+		if err := preFlightCheck(cfg, svc); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// run performs the action once. The IP file is read on every run so
+	// scheduled syncs pick up changes to it.
+	run := func() (err error) {
+		dnsCache = nil
+		if *summaryFile != "" || *metricsFile != "" {
+			summaryRecords = []operationRecord{}
+		}
+		if *summaryFile != "" {
+			defer func() {
+				if werr := writeSummaryFile(*summaryFile); werr != nil {
+					err = errors.Join(err, fmt.Errorf("failed to write summary file: %w", werr))
+				}
+			}()
+		}
+		if *metricsFile != "" {
+			defer func() {
+				if werr := writeMetricsFile(*metricsFile, summaryRecords); werr != nil {
+					err = errors.Join(err, fmt.Errorf("failed to write metrics file: %w", werr))
+				}
+			}()
+		}
+		if *lockBeforeUpdate && modifyingActions[*action] {
+			// Not err, which the deferred release joins its error into.
+			lock, lerr := acquireLock(dynamodb.NewFromConfig(cfg), *lockTable, lockID, *lockTTL)
+			if lerr != nil {
+				return lerr
+			}
+			defer func() {
+				if rerr := lock.release(); rerr != nil {
+					err = errors.Join(err, rerr)
 				}
-			} else if isIPv6(ip) {
-				if _, exists := ipv6Set[ip]; !exists {
-					ipv6Set[ip] = struct{}{}
-					ipv6s = append(ipv6s, ip)
+			}()
+		}
+		if *action == "bulk" {
+			return runBulk(svc, bulkItems, mergeTags(globalTags, tags))
+		}
+
+		var ipv4s, ipv6s []prefixEntry
+		if (*action == "create" || *action == "update") && *applyPlan == "" {
+			var err error
+			ipv4s, ipv6s, err = readIPsFromFile(*filePath)
+			if err != nil {
+				return fmt.Errorf("failed to read IPs from file: %w", err)
+			}
+			if *warnOnEmpty && len(ipv4s) == 0 && len(ipv6s) == 0 {
+				// An empty prefix list usually blocks all the traffic
+				// it was meant to allow.
+				if opts.strict {
+					return fmt.Errorf("no CIDRs found in %s", *filePath)
 				}
+				log.Printf("Warning: no CIDRs found in %s; the prefix lists will be empty", *filePath)
 			}
 		}
+
+		if *costEstimate {
+			return estimateCosts(svc, *prefixListName, *prefixListID, ipv4s, ipv6s)
+		}
+
+		var steps []func() error
+		switch *action {
+		case "create":
+			var err error
+			if steps, err = prefixListSteps(svc, *action, *prefixListName, ipv4s, ipv6s, tags); err != nil {
+				return err
+			}
+		case "update":
+			if *applyPlan != "" {
+				steps = append(steps, func() error { return applyPlanFile(svc, *applyPlan) })
+				break
+			}
+			if *outputPlanFile != "" {
+				pendingPlan = &changePlan{CreatedAt: time.Now().UTC()}
+			}
+			if *prefixListID != "" {
+				steps = append(steps, func() error { return updateByPrefixListID(svc, *prefixListID, ipv4s, ipv6s) })
+				break
+			}
+			var err error
+			if steps, err = prefixListSteps(svc, *action, *prefixListName, ipv4s, ipv6s, tags); err != nil {
+				return err
+			}
+		case "list":
+			steps = append(steps, func() error { return listPrefixLists(svc, *groupByTag, *sortBy, *filterState) })
+		case "describe":
+			if *exportFormat == "aws-cli" {
+				steps = append(steps, func() error { return exportAWSCLI(svc, *prefixListName, *prefixListID) })
+				break
+			}
+			steps = append(steps, func() error { return describePrefixListEntries(svc, *prefixListName, *prefixListID) })
+		case "discover":
+			steps = append(steps, func() error { return discoverPrefixLists(svc, tags) })
+		case "wait":
+			steps = append(steps, func() error { return waitForPrefixLists(svc, *prefixListName, *prefixListID) })
+		case "audit":
+			steps = append(steps, func() error {
+				results, err := auditPrefixLists(svc, *namePrefix, *auditDir)
+				if err != nil {
+					return err
+				}
+				printAuditResults(results)
+				if n := countOutOfSync(results); n > 0 {
+					return fmt.Errorf("%d prefix list(s) out of sync", n)
+				}
+				return nil
+			})
+		case "check-drift":
+			steps = append(steps, func() error {
+				results, err := checkDrift(svc, *s3Bucket, *s3Prefix)
+				if err != nil {
+					return err
+				}
+				printAuditResults(results)
+				if n := countOutOfSync(results); n > 0 {
+					return fmt.Errorf("%d prefix list(s) drifted from S3", n)
+				}
+				return nil
+			})
+		case "check-permissions":
+			steps = append(steps, func() error { return checkPermissions(cfg, *policyResource) })
+		case "copy-tags":
+			steps = append(steps, func() error { return copyPrefixListTags(svc, *prefixListName, *copyTarget, *overwriteTags) })
+		case "purge":
+			steps = append(steps, func() error { return purgePrefixLists(svc, *prefixListName, *prefixListID) })
+		case "test-credentials":
+			steps = append(steps, func() error { return testCredentials(cfg) })
+		case "expire":
+			steps = append(steps, func() error { return expirePrefixListEntries(svc, *prefixListName, *prefixListID) })
+		case "health":
+			steps = append(steps, func() error {
+				return checkHealth(cfg, svc, *prefixListName, *prefixListID, *minEntries, *maxEntries)
+			})
+		case "reconcile":
+			steps = append(steps, func() error { return reconcilePrefixLists(svc, *namePrefix, *auditDir, *dryRun) })
+		case "events":
+			steps = append(steps, func() error { return showPrefixListEvents(svc, *prefixListName, *prefixListID, *showDiff) })
+		case "list-versions":
+			steps = append(steps, func() error { return listVersions(svc, *prefixListName, *prefixListID, *limitVersions) })
+		case "compare-versions":
+			steps = append(steps, func() error {
+				return compareVersions(svc, *prefixListName, *prefixListID, *versionA, *versionB)
+			})
+		}
+		if err := runSteps(steps); err != nil {
+			return err
+		}
+		if pendingPlan != nil {
+			return writePlanFile(*outputPlanFile)
+		}
+
+		// The entries files record what was sent to AWS, so they are only
+		// written once a create or update from -file has been applied.
+		if (*action != "create" && *action != "update") || *applyPlan != "" {
+			return nil
+		}
+		if *entriesFile != "" {
+			if err := writeEntriesFile(*entriesFile, cidrsOf(ipv4s)); err != nil {
+				return err
+			}
+		}
+		if *entriesFileIPv6 != "" {
+			if err := writeEntriesFile(*entriesFileIPv6, cidrsOf(ipv6s)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if *schedule != "" {
+		if isPipe(*filePath) {
+			log.Fatal("-schedule cannot re-read a pipe; -file must be a regular file or URL")
+		}
+		log.Fatal(runScheduled(*schedule, *runOnceOnStart, run))
+	}
+	if err := run(); err != nil {
+		log.Print(err)
+		os.Exit(exitCode(err))
+	}
+}
+
+// modifyingActions are the actions that change prefix lists, and so take the
+// -lock-before-update lock.
+var modifyingActions = map[string]bool{
+	"create":    true,
+	"update":    true,
+	"expire":    true,
+	"purge":     true,
+	"reconcile": true,
+	"bulk":      true,
+}
+
+// Exit codes other than the generic failure let scripts tell apart the
+// outcomes they may want to handle.
+const (
+	exitFailure  = 1
+	exitExists   = 3
+	exitNotFound = 4
+)
+
+// existsError reports that a prefix list to be created already exists.
+type existsError struct {
+	name string
+	id   string
+}
+
+func (e *existsError) Error() string {
+	return fmt.Sprintf("prefix list '%s' already exists (ID: %s); use -action update", e.name, e.id)
+}
+
+// excludedError reports that a prefix list exists under the name but is
+// excluded by -filter-tag, so it can be neither updated nor created again.
+type excludedError struct {
+	name string
+	id   string
+}
+
+func (e *excludedError) Error() string {
+	return fmt.Sprintf("prefix list '%s' exists (ID: %s) but is excluded by -filter-tag", e.name, e.id)
+}
+
+// notFoundError reports that a prefix list to be updated does not exist.
+type notFoundError struct {
+	name string
+}
+
+func (e *notFoundError) Error() string {
+	return fmt.Sprintf("prefix list '%s' not found; names must match exactly, including the -ipv4/-ipv6 suffix", e.name)
+}
+
+// exitCode maps an error returned by an action to the process exit code.
+func exitCode(err error) int {
+	var exists *existsError
+	if errors.As(err, &exists) {
+		return exitExists
+	}
+	var notFound *notFoundError
+	if errors.As(err, &notFound) {
+		return exitNotFound
+	}
+	return exitFailure
+}
+
+// isFlagSet reports whether the named flag was given on the command line.
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// compileFlagRegexp compiles the regular expression given to the named
+// flag, exiting if it is invalid. An empty pattern gives nil.
+func compileFlagRegexp(name, pattern string) *regexp.Regexp {
+	if pattern == "" {
+		return nil
 	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		log.Fatalf("Invalid -%s: %v", name, err)
+	}
+	return re
+}
 
-	if err := scanner.Err(); err != nil {
-		return nil, nil, err
+// promptIfMissing asks for value on the terminal when it is empty.
+func promptIfMissing(stdin *bufio.Reader, value *string, label string) {
+	for *value == "" {
+		fmt.Fprintf(os.Stderr, "Enter %s: ", label)
+		line, err := stdin.ReadString('\n')
+		*value = strings.TrimSpace(line)
+		if err != nil {
+			return
+		}
 	}
+}
 
-	return ipv4s, ipv6s, nil
+// prefixListTarget is one prefix list to create or update and the entries
+// it should hold.
+type prefixListTarget struct {
+	name          string
+	addressFamily string
+	ips           []prefixEntry
 }
 
-func isIPv4(ip string) bool {
-	_, _, err := net.ParseCIDR(ip)
-	return err == nil && strings.Contains(ip, ".")
+// prefixListTargets splits the entries into prefix lists according to
+// -ip-version-strategy: <name>-ipv4 and <name>-ipv6 by default, or a single
+// list named <name> holding whichever family has entries.
+//
+// -address-family limits the targets to one family.
+func prefixListTargets(name string, ipv4s, ipv6s []prefixEntry) ([]prefixListTarget, error) {
+	switch opts.addressFamily {
+	case "ipv4":
+		ipv6s = nil
+	case "ipv6":
+		ipv4s = nil
+	}
+	if opts.ipVersionStrategy != "single" {
+		switch opts.addressFamily {
+		case "ipv4":
+			return []prefixListTarget{{name + "-ipv4", "IPv4", ipv4s}}, nil
+		case "ipv6":
+			return []prefixListTarget{{name + "-ipv6", "IPv6", ipv6s}}, nil
+		}
+		if (len(ipv4s) == 0) != (len(ipv6s) == 0) {
+			log.Printf("Warning: the input for %s has entries of only one address family; use -address-family to manage just that family", name)
+		}
+		return []prefixListTarget{
+			{name + "-ipv4", "IPv4", ipv4s},
+			{name + "-ipv6", "IPv6", ipv6s},
+		}, nil
+	}
+	// A prefix list holds a single address family.
+	if len(ipv4s) > 0 && len(ipv6s) > 0 {
+		return nil, fmt.Errorf("-ip-version-strategy single needs entries of one address family, got %d IPv4 and %d IPv6", len(ipv4s), len(ipv6s))
+	}
+	if len(ipv6s) > 0 {
+		return []prefixListTarget{{name, "IPv6", ipv6s}}, nil
+	}
+	return []prefixListTarget{{name, "IPv4", ipv4s}}, nil
 }
 
-func isIPv6(ip string) bool {
-	_, _, err := net.ParseCIDR(ip)
-	return err == nil && strings.Contains(ip, ":")
+// prefixListSteps returns the steps that create or update the prefix lists
+// stored under name, one per target list.
+func prefixListSteps(svc *ec2.Client, action, name string, ipv4s, ipv6s []prefixEntry, tags []types.Tag) ([]func() error, error) {
+	targets, err := prefixListTargets(name, ipv4s, ipv6s)
+	if err != nil {
+		return nil, err
+	}
+	if action == "update" && opts.failIfNotExists {
+		for _, t := range targets {
+			existing, err := findPrefixListByName(svc, t.name)
+			if err != nil {
+				return nil, err
+			}
+			if existing == nil {
+				return nil, &notFoundError{name: t.name}
+			}
+		}
+	}
+	if action == "create" && opts.failIfExists {
+		// Check every list up front so that an existing IPv6 list does not
+		// fail the run only after the IPv4 list was created.
+		for _, t := range targets {
+			existing, err := prefixListNameTaken(svc, t.name)
+			if err != nil {
+				return nil, err
+			}
+			if existing != nil {
+				return nil, &existsError{name: t.name, id: aws.ToString(existing.PrefixListId)}
+			}
+		}
+	}
+	var steps []func() error
+	for _, t := range targets {
+		steps = append(steps, emptyListStep(svc, t.name, t.ips, func() error {
+			switch {
+			case action == "update" && opts.createIfNotExists:
+				existing, err := findPrefixListByName(svc, t.name)
+				if err != nil {
+					return err
+				}
+				if existing == nil {
+					log.Printf("Prefix list %s not found, creating it", t.name)
+					err := createPrefixList(svc, t.name, t.addressFamily, t.ips, tags)
+					var exists *existsError
+					if errors.As(err, &exists) {
+						return &excludedError{name: t.name, id: exists.id}
+					}
+					return err
+				}
+				return updatePrefixListByID(svc, aws.ToString(existing.PrefixListId), t.ips)
+			case action == "update":
+				return updatePrefixList(svc, t.name, t.ips)
+			case opts.idempotent:
+				return ensurePrefixList(svc, t, tags)
+			case opts.skipIfExists:
+				err := createPrefixList(svc, t.name, t.addressFamily, t.ips, tags)
+				var exists *existsError
+				if errors.As(err, &exists) {
+					log.Printf("Prefix list %s already exists (ID: %s), skipping", t.name, exists.id)
+					return nil
+				}
+				return err
+			default:
+				return createPrefixList(svc, t.name, t.addressFamily, t.ips, tags)
+			}
+		}))
+	}
+	return steps, nil
+}
+
+// prefixListNames returns the names the lists for name are stored under.
+func prefixListNames(name string) []string {
+	if opts.ipVersionStrategy == "single" {
+		return []string{name}
+	}
+	return []string{name + "-ipv4", name + "-ipv6"}
+}
+
+// emptyListStep wraps the step that creates or updates the named list so
+// that -empty-list-behavior applies when the list's family has no entries.
+func emptyListStep(svc *ec2.Client, name string, ips []prefixEntry, step func() error) func() error {
+	return func() error {
+		if len(ips) > 0 {
+			return step()
+		}
+		switch opts.emptyListBehavior {
+		case "skip":
+			log.Printf("Skipping %s: no entries", name)
+			return nil
+		case "delete":
+			pl, err := findPrefixListByName(svc, name)
+			if err != nil {
+				return err
+			}
+			if pl == nil {
+				log.Printf("Skipping %s: no entries", name)
+				return nil
+			}
+			return deletePrefixList(svc, aws.ToString(pl.PrefixListId))
+		}
+		return step()
+	}
+}
+
+// runSteps runs each step in order. With fail-fast the first error stops the
+// run; otherwise every step runs and the errors are joined.
+func runSteps(steps []func() error) error {
+	var errs []error
+	for _, step := range steps {
+		if err := step(); err != nil {
+			if opts.failFast {
+				return err
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
 }
 
-func createPrefixList(svc *ec2.Client, name, addressFamily string, ips []string) {
+func createPrefixList(svc *ec2.Client, name, addressFamily string, ips []prefixEntry, tags []types.Tag) (err error) {
+	// CreateManagedPrefixList takes at most 100 entries, like each
+	// ModifyManagedPrefixList call. The list is created with the first 100
+	// and the rest are added by one modify call per further 100.
 	const maxEntriesPerRequest = 100
+
+	// EC2 does not enforce unique prefix list names, so check first rather
+	// than silently creating a second list that name lookups cannot tell
+	// apart from the first.
+	existing, err := prefixListNameTaken(svc, name)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return &existsError{name: name, id: aws.ToString(existing.PrefixListId)}
+	}
+	if opts.autoCreateTags {
+		tags = mergeTags(tags, creationTags())
+	}
+
 	totalEntries := len(ips)
-	numRequests := (totalEntries + maxEntriesPerRequest - 1) / maxEntriesPerRequest
+	// An empty list still takes one request to create.
+	numRequests := max(1, (totalEntries+maxEntriesPerRequest-1)/maxEntriesPerRequest)
 
 	var prefixListID string
 	var currentVersion int64 = 1
+	var errs []error
+
+	m := newOperationReport("create")
+	m.name, m.addressFamily = name, addressFamily
+	m.before, m.added = aws.Int(0), len(ips)
+	defer func() {
+		m.prefixListID = prefixListID
+		reportOperation(svc, m, err)
+	}()
 
 	for i := 0; i < numRequests; i++ {
 		start := i * maxEntriesPerRequest
@@ -117,105 +1156,498 @@ func createPrefixList(svc *ec2.Client, name, addressFamily string, ips []string)
 
 		entries := make([]types.AddPrefixListEntry, end-start)
 		for j, ip := range ips[start:end] {
-			entries[j] = types.AddPrefixListEntry{
-				Cidr: aws.String(ip),
-			}
+			entries[j] = addPrefixListEntry(ip)
 		}
 
 		if i == 0 {
 			input := &ec2.CreateManagedPrefixListInput{
 				PrefixListName: aws.String(name),
 				AddressFamily:  aws.String(addressFamily),
-				MaxEntries:     aws.Int32(int32(totalEntries)), // Set MaxEntries to total number of entries
+				MaxEntries:     aws.Int32(int32(maxEntriesWithHeadroom(totalEntries))),
 				Entries:        entries,
 			}
+			if len(tags) > 0 {
+				input.TagSpecifications = []types.TagSpecification{
+					{ResourceType: types.ResourceTypePrefixList, Tags: tags},
+				}
+			}
 
+			// Nothing can be retried without the list itself, so a failed
+			// create always aborts regardless of fail-fast.
 			result, err := svc.CreateManagedPrefixList(context.TODO(), input)
 			if err != nil {
-				log.Fatalf("Failed to create prefix list: %v", err)
+				return fmt.Errorf("failed to create prefix list: %w", err)
 			}
 			prefixListID = *result.PrefixList.PrefixListId
 			currentVersion = *result.PrefixList.Version
-			fmt.Printf("Created prefix list with ID: %s\n", prefixListID)
+			logChanges(prefixListID, currentVersion, entries, nil)
+			printChanges(prefixListID, currentVersion, entries, nil)
+			if !jsonOutput() {
+				fmt.Printf("Created prefix list with ID: %s\n", prefixListID)
+			}
 		} else {
-			// Fetch the latest version before each modification
-			currentVersion = getCurrentVersion(svc, prefixListID)
+			// Fetch the latest version before each modification. With
+			// -skip-version-check the version the previous batch produced
+			// is used instead, as nothing else should be modifying a list
+			// this run has just created.
+			if !opts.skipVersionCheck {
+				var err error
+				currentVersion, err = getCurrentVersion(svc, prefixListID)
+				if err != nil {
+					return err
+				}
+			}
 
 			updateInput := &ec2.ModifyManagedPrefixListInput{
 				PrefixListId:   aws.String(prefixListID),
 				CurrentVersion: aws.Int64(currentVersion),
 				AddEntries:     entries,
 			}
-			result, err := svc.ModifyManagedPrefixList(context.TODO(), updateInput)
+			_, err := svc.ModifyManagedPrefixList(context.TODO(), updateInput)
 			if err != nil {
-				log.Fatalf("Failed to update prefix list: %v", err)
+				err = fmt.Errorf("failed to update prefix list (batch %d of %d): %w", i+1, numRequests, err)
+				if opts.failFast {
+					return err
+				}
+				log.Print(err)
+				errs = append(errs, err)
+				continue
+			}
+			// The response describes the list as it was before the
+			// modification, so the version it produces is the next one.
+			currentVersion++
+			logChanges(prefixListID, currentVersion, entries, nil)
+			printChanges(prefixListID, currentVersion, entries, nil)
+			if !jsonOutput() {
+				fmt.Printf("Updated prefix list with ID: %s\n", prefixListID)
 			}
-			currentVersion = *result.PrefixList.Version
-			fmt.Printf("Updated prefix list with ID: %s\n", prefixListID)
+		}
+		// An empty create has no entries to report progress on.
+		if totalEntries > 0 {
+			printProgress(i+1, numRequests, start+1, end)
 		}
 
 		// Wait for the prefix list to be ready for the next modification
-		waitForPrefixListReady(svc, prefixListID)
+		if opts.noWait {
+			continue
+		}
+		if err := waitForPrefixListReady(svc, prefixListID, false); err != nil {
+			return err
+		}
 	}
+
+	return errors.Join(errs...)
 }
 
-func updatePrefixList(svc *ec2.Client, name string, ips []string) {
-	const maxEntriesPerRequest = 100
+// deleteIfEmpty deletes the prefix list once it is ready if it holds no
+// entries.
+func deleteIfEmpty(svc *ec2.Client, prefixListID string) error {
+	// A list that is still being modified cannot be deleted.
+	if err := waitForPrefixListReady(svc, prefixListID, false); err != nil {
+		return err
+	}
+	entries, err := getPrefixListEntries(svc, prefixListID)
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return nil
+	}
+	log.Printf("Prefix list %s is empty after the update, deleting it", prefixListID)
+	return deletePrefixList(svc, prefixListID)
+}
+
+// ensurePrefixList creates the target list, or updates it to the target
+// entries if it already exists, so that -action create can be rerun.
+func ensurePrefixList(svc *ec2.Client, t prefixListTarget, tags []types.Tag) error {
+	err := createPrefixList(svc, t.name, t.addressFamily, t.ips, tags)
+	var exists *existsError
+	if errors.As(err, &exists) {
+		// The name check before a create ignores -filter-tag, but the update
+		// does not, so a list the filter excludes must not be updated.
+		if len(opts.filterTags) > 0 {
+			pl, err := findPrefixListByName(svc, t.name)
+			if err != nil {
+				return err
+			}
+			if pl == nil {
+				return &excludedError{name: t.name, id: exists.id}
+			}
+		}
+		log.Printf("Prefix list %s already exists, updating it instead", t.name)
+		return updatePrefixListByID(svc, exists.id, t.ips)
+	}
+	return err
+}
+
+// maxEntriesWithHeadroom returns the MaxEntries to create a list with: the
+// entry count plus -max-entries-headroom-percent, rounded up.
+// EC2 requires room for at least one entry.
+func maxEntriesWithHeadroom(entries int) int {
+	return max(1, (entries*(100+opts.headroomPercent)+99)/100)
+}
+
+func updatePrefixList(svc *ec2.Client, name string, ips []prefixEntry) error {
+	pl, err := findPrefixListByName(svc, name)
+	if err != nil {
+		return err
+	}
+	if pl == nil {
+		return fmt.Errorf("prefix list with name %s not found", name)
+	}
+	return updatePrefixListByID(svc, *pl.PrefixListId, ips)
+}
+
+// listPrefixLists prints every prefix list in the account and region,
+// narrowed by -filter-tag, along with its entry count.
+// With groupByTag the lists are grouped by the value of that tag, and with
+// sortBy they are sorted as -sort-by describes. With filterState only lists
+// in that state are shown; the state is filtered here rather than by the
+// API, so the whole result set is paginated first.
+func listPrefixLists(svc *ec2.Client, groupByTag, sortBy, filterState string) error {
+	prefixLists, err := describePrefixLists(svc, tagFilters(nil))
+	if err != nil {
+		return err
+	}
+	if filterState != "" {
+		prefixLists = slices.DeleteFunc(prefixLists, func(pl types.ManagedPrefixList) bool {
+			return string(pl.State) != filterState
+		})
+	}
+
+	counts := make(map[string]int)
+	countEntries := func(lists []types.ManagedPrefixList) error {
+		for _, pl := range lists {
+			id := aws.ToString(pl.PrefixListId)
+			if _, ok := counts[id]; ok {
+				continue
+			}
+			entries, err := getPrefixListEntries(svc, id)
+			if err != nil {
+				return err
+			}
+			counts[id] = len(entries)
+		}
+		return nil
+	}
+	// Sorting by entry count needs every count up front; otherwise limit
+	// before counting entries, which takes a call per list.
+	if sortBy == "entry-count" {
+		if err := countEntries(prefixLists); err != nil {
+			return err
+		}
+	}
+	sortPrefixLists(prefixLists, sortBy, counts)
+	prefixLists = limitResults(prefixLists, "prefix lists")
+	if err := countEntries(prefixLists); err != nil {
+		return err
+	}
+	summaries := summarizePrefixLists(prefixLists)
+	for i := range summaries {
+		summaries[i].EntryCount = aws.Int(counts[summaries[i].ID])
+	}
+	if groupByTag != "" {
+		printPrefixListGroups(groupPrefixLists(prefixLists, summaries, groupByTag))
+		return nil
+	}
+	printPrefixLists(summaries)
+	return nil
+}
+
+// sortPrefixLists orders prefixLists for -sort-by, keeping the API order for
+// ties. counts holds the entry count of each list by ID for entry-count.
+func sortPrefixLists(prefixLists []types.ManagedPrefixList, sortBy string, counts map[string]int) {
+	byName := func(a, b types.ManagedPrefixList) int {
+		return strings.Compare(aws.ToString(a.PrefixListName), aws.ToString(b.PrefixListName))
+	}
+	switch sortBy {
+	case "name":
+		slices.SortStableFunc(prefixLists, byName)
+	case "version":
+		slices.SortStableFunc(prefixLists, func(a, b types.ManagedPrefixList) int {
+			return cmp.Compare(aws.ToInt64(b.Version), aws.ToInt64(a.Version))
+		})
+	case "state":
+		slices.SortStableFunc(prefixLists, func(a, b types.ManagedPrefixList) int {
+			return cmp.Or(strings.Compare(string(a.State), string(b.State)), byName(a, b))
+		})
+	case "entry-count":
+		slices.SortStableFunc(prefixLists, func(a, b types.ManagedPrefixList) int {
+			return cmp.Compare(counts[aws.ToString(b.PrefixListId)], counts[aws.ToString(a.PrefixListId)])
+		})
+	}
+}
+
+// describePrefixListEntries prints the entries of the named lists, or of the
+// list with the given ID.
+func describePrefixListEntries(svc *ec2.Client, name, prefixListID string) error {
+	prefixLists, err := resolvePrefixLists(svc, name, prefixListID)
+	if err != nil {
+		return err
+	}
+	var described []describedEntry
+	for _, pl := range prefixLists {
+		entries, err := listPrefixListEntries(svc, aws.ToString(pl.PrefixListId), 0)
+		if err != nil {
+			return err
+		}
+		var added map[string]int64
+		if opts.verbose {
+			added = addedVersions(svc, aws.ToString(pl.PrefixListId), aws.ToInt64(pl.Version), entries)
+		}
+		for _, entry := range entries {
+			cidr := aws.ToString(entry.Cidr)
+			described = append(described, describedEntry{
+				PrefixList:            aws.ToString(pl.PrefixListName),
+				CIDR:                  cidr,
+				Description:           aws.ToString(entry.Description),
+				AddedInVersion:        added[cidr],
+				AddedInCurrentVersion: opts.verbose && added[cidr] == aws.ToInt64(pl.Version),
+			})
+		}
+	}
+	printEntries(limitResults(described, "entries"))
+	return nil
+}
+
+// discoverPrefixLists prints every prefix list carrying all of the given tags.
+func discoverPrefixLists(svc *ec2.Client, tags []types.Tag) error {
+	prefixLists, err := describePrefixLists(svc, tagFilters(tags))
+	if err != nil {
+		return err
+	}
+	printPrefixLists(summarizePrefixLists(prefixLists))
+	return nil
+}
+
+// describePrefixLists returns every prefix list matching the filters,
+// following pagination.
+func describePrefixLists(svc *ec2.Client, filters []types.Filter) ([]types.ManagedPrefixList, error) {
+	var prefixLists []types.ManagedPrefixList
+	describeInput := &ec2.DescribeManagedPrefixListsInput{Filters: filters}
+	paginator := ec2.NewDescribeManagedPrefixListsPaginator(svc, describeInput)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe prefix lists: %w", err)
+		}
+		prefixLists = append(prefixLists, page.PrefixLists...)
+	}
+	return prefixLists, nil
+}
+
+// tagFilters converts tags into DescribeManagedPrefixLists filters, adding
+// the -filter-tag flags. The API ANDs separate filters together.
+func tagFilters(tags []types.Tag) []types.Filter {
+	var filters []types.Filter
+	for _, tag := range slices.Concat(tags, opts.filterTags) {
+		filters = append(filters, types.Filter{
+			Name:   aws.String("tag:" + aws.ToString(tag.Key)),
+			Values: []string{aws.ToString(tag.Value)},
+		})
+	}
+	return filters
+}
+
+// findPrefixListByName returns the prefix list with the given name among
+// those matching -filter-tag, or nil if there is none. Filtering is done by
+// the API so every page is covered.
+func findPrefixListByName(svc *ec2.Client, name string) (*types.ManagedPrefixList, error) {
+	return lookupPrefixListByName(svc, name, tagFilters(nil))
+}
+
+// prefixListNameTaken returns any list named name, ignoring -filter-tag. A
+// list hidden by the filter still makes a new list of the same name
+// ambiguous, so existence checks before a create use this.
+func prefixListNameTaken(svc *ec2.Client, name string) (*types.ManagedPrefixList, error) {
+	return lookupPrefixListByName(svc, name, nil)
+}
+
+func lookupPrefixListByName(svc *ec2.Client, name string, filters []types.Filter) (*types.ManagedPrefixList, error) {
+	describeInput := &ec2.DescribeManagedPrefixListsInput{
+		Filters: append(filters, types.Filter{
+			Name:   aws.String("prefix-list-name"),
+			Values: []string{name},
+		}),
+	}
+	paginator := ec2.NewDescribeManagedPrefixListsPaginator(svc, describeInput)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe prefix lists: %w", err)
+		}
+		for _, pl := range page.PrefixLists {
+			if *pl.PrefixListName == name {
+				return &pl, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// resolvePrefixLists returns the prefix list with the given ID, or else the
+// lists stored under name (see prefixListNames) that exist.
+func resolvePrefixLists(svc *ec2.Client, name, prefixListID string) ([]types.ManagedPrefixList, error) {
+	if prefixListID != "" {
+		pl, err := describePrefixList(svc, prefixListID)
+		if err != nil {
+			return nil, err
+		}
+		return []types.ManagedPrefixList{*pl}, nil
+	}
+
+	var prefixLists []types.ManagedPrefixList
+	names := prefixListNames(name)
+	for _, n := range names {
+		pl, err := findPrefixListByName(svc, n)
+		if err != nil {
+			return nil, err
+		}
+		if pl != nil {
+			prefixLists = append(prefixLists, *pl)
+		}
+	}
+	if len(prefixLists) == 0 {
+		return nil, fmt.Errorf("no prefix list named %s found", strings.Join(names, " or "))
+	}
+	return prefixLists, nil
+}
 
-	// Find the prefix list by name
-	describeInput := &ec2.DescribeManagedPrefixListsInput{}
+// describePrefixList returns the prefix list with the given ID.
+func describePrefixList(svc *ec2.Client, prefixListID string) (*types.ManagedPrefixList, error) {
+	describeInput := &ec2.DescribeManagedPrefixListsInput{
+		PrefixListIds: []string{prefixListID},
+		Filters:       tagFilters(nil),
+	}
 	describeResult, err := svc.DescribeManagedPrefixLists(context.TODO(), describeInput)
 	if err != nil {
-		log.Fatalf("Failed to describe prefix lists: %v", err)
+		return nil, fmt.Errorf("failed to describe prefix list: %w", err)
 	}
+	if len(describeResult.PrefixLists) == 0 {
+		return nil, fmt.Errorf("prefix list with ID %s not found", prefixListID)
+	}
+	return &describeResult.PrefixLists[0], nil
+}
 
-	var prefixListID string
-	for _, pl := range describeResult.PrefixLists {
-		if *pl.PrefixListName == name {
-			prefixListID = *pl.PrefixListId
-			break
+// updateByPrefixListID updates a single prefix list identified by ID, using
+// the IPs that match its address family.
+func updateByPrefixListID(svc *ec2.Client, prefixListID string, ipv4s, ipv6s []prefixEntry) error {
+	pl, err := describePrefixList(svc, prefixListID)
+	if err != nil {
+		return err
+	}
+	ips := ipv4s
+	if aws.ToString(pl.AddressFamily) == "IPv6" {
+		ips = ipv6s
+	}
+	return emptyListStep(svc, aws.ToString(pl.PrefixListName), ips, func() error {
+		return updatePrefixListByID(svc, prefixListID, ips)
+	})()
+}
+
+func updatePrefixListByID(svc *ec2.Client, prefixListID string, ips []prefixEntry) error {
+	m := newOperationReport("update")
+
+	if opts.idempotent {
+		// Plan against a settled list rather than one a previous run is
+		// still modifying.
+		if err := waitForPrefixListReady(svc, prefixListID, false); err != nil {
+			return err
 		}
 	}
 
-	if prefixListID == "" {
-		log.Fatalf("Prefix list with name %s not found", name)
+	if opts.requireVersion > 0 {
+		version, err := getCurrentVersion(svc, prefixListID)
+		if err != nil {
+			return err
+		}
+		if version != opts.requireVersion {
+			return fmt.Errorf("prefix list %s: expected version %d, got %d", prefixListID, opts.requireVersion, version)
+		}
 	}
 
-	// Get current version of the prefix list
-	currentVersion := getCurrentVersion(svc, prefixListID)
+	// A plan records the version its changes were computed against, so
+	// the entries are read at the version described.
+	var planned *types.ManagedPrefixList
+	var version int64
+	if pendingPlan != nil {
+		var err error
+		if planned, err = describePrefixList(svc, prefixListID); err != nil {
+			return err
+		}
+		version = aws.ToInt64(planned.Version)
+	}
 
 	// Determine entries to add and remove
-	currentEntries := make(map[string]bool)
-	entriesInput := &ec2.GetManagedPrefixListEntriesInput{
-		PrefixListId: aws.String(prefixListID),
-	}
-	entriesResult, err := svc.GetManagedPrefixListEntries(context.TODO(), entriesInput)
+	currentEntries, err := listPrefixListEntries(svc, prefixListID, version)
 	if err != nil {
-		log.Fatalf("Failed to get prefix list entries: %v", err)
+		return err
+	}
+	toAdd, toRemove := planChanges(currentEntries, ips)
+
+	if planned != nil {
+		addToPlan(planned, toAdd, toRemove)
+		return nil
+	}
+	if err := applyPrefixListChanges(svc, m, prefixListID, currentEntries, toAdd, toRemove); err != nil {
+		return err
+	}
+	if opts.deleteEmptyAfterUpdate {
+		return deleteIfEmpty(svc, prefixListID)
+	}
+	return nil
+}
+
+// applyPrefixListChanges adds toAdd to and removes toRemove from the list in
+// batches, reporting the operation through m. currentEntries are the entries
+// the changes were planned against.
+func applyPrefixListChanges(svc *ec2.Client, m operationReport, prefixListID string, currentEntries []types.PrefixListEntry, toAdd []prefixEntry, toRemove []string) (err error) {
+	const maxEntriesPerRequest = 100
+
+	m.prefixListID = prefixListID
+	m.before, m.added, m.removed = aws.Int(len(currentEntries)), len(toAdd), len(toRemove)
+	defer func() { reportOperation(svc, m, err) }()
+
+	if opts.snapshotBeforeUpdate && (len(toAdd) > 0 || len(toRemove) > 0) {
+		if err := snapshotPrefixList(svc, prefixListID, currentEntries); err != nil {
+			return err
+		}
+	}
+
+	if len(toAdd) > 0 {
+		if err := ensureCapacity(svc, prefixListID, peakEntries(len(currentEntries), len(toAdd), len(toRemove), maxEntriesPerRequest)); err != nil {
+			return err
+		}
 	}
-	for _, entry := range entriesResult.Entries {
-		currentEntries[*entry.Cidr] = true
+
+	// With -rollback-on-error, a failure part way through restores the
+	// version the list had before the first batch.
+	fail := func(err error) error { return err }
+	if opts.rollbackOnError && (len(toAdd) > 0 || len(toRemove) > 0) {
+		startVersion, err := getCurrentVersion(svc, prefixListID)
+		if err != nil {
+			return err
+		}
+		fail = func(err error) error { return rollbackPrefixList(svc, prefixListID, startVersion, err) }
 	}
 
 	var addEntries []types.AddPrefixListEntry
 	var removeEntries []types.RemovePrefixListEntry
 
-	for _, ip := range ips {
-		if !currentEntries[ip] {
-			addEntries = append(addEntries, types.AddPrefixListEntry{
-				Cidr: aws.String(ip),
-			})
-		}
-		delete(currentEntries, ip)
+	for _, ip := range toAdd {
+		addEntries = append(addEntries, addPrefixListEntry(ip))
 	}
 
-	for ip := range currentEntries {
+	for _, ip := range toRemove {
 		removeEntries = append(removeEntries, types.RemovePrefixListEntry{
 			Cidr: aws.String(ip),
 		})
 	}
 
 	// Update the prefix list in chunks
+	numRequests := (max(len(addEntries), len(removeEntries)) + maxEntriesPerRequest - 1) / maxEntriesPerRequest
+	var currentVersion int64
+	var errs []error
 	for i := 0; i < len(addEntries) || i < len(removeEntries); i += maxEntriesPerRequest {
 		endAdd := i + maxEntriesPerRequest
 		if endAdd > len(addEntries) {
@@ -225,55 +1657,378 @@ func updatePrefixList(svc *ec2.Client, name string, ips []string) {
 		if endRemove > len(removeEntries) {
 			endRemove = len(removeEntries)
 		}
+		batch := i/maxEntriesPerRequest + 1
 
-		// Fetch the latest version before each modification
-		currentVersion = getCurrentVersion(svc, prefixListID)
+		// Fetch the latest version before each modification, or with
+		// -skip-version-check only before the first
+		if i == 0 || !opts.skipVersionCheck {
+			if currentVersion, err = getCurrentVersion(svc, prefixListID); err != nil {
+				return fail(err)
+			}
+		}
 
 		updateInput := &ec2.ModifyManagedPrefixListInput{
 			PrefixListId:   aws.String(prefixListID),
 			CurrentVersion: aws.Int64(currentVersion),
-			AddEntries:     addEntries[i:endAdd],
-			RemoveEntries:  removeEntries[i:endRemove],
+			AddEntries:     addEntries[min(i, endAdd):endAdd],
+			RemoveEntries:  removeEntries[min(i, endRemove):endRemove],
 		}
 
-		result, err := svc.ModifyManagedPrefixList(context.TODO(), updateInput)
+		_, err := svc.ModifyManagedPrefixList(context.TODO(), updateInput)
 		if err != nil {
-			log.Fatalf("Failed to update prefix list: %v", err)
+			err = fmt.Errorf("failed to update prefix list (batch %d of %d): %w", batch, numRequests, err)
+			if opts.failFast {
+				return fail(err)
+			}
+			log.Print(err)
+			errs = append(errs, err)
+			continue
 		}
-		currentVersion = *result.PrefixList.Version
-		fmt.Printf("Updated prefix list with ID: %s\n", prefixListID)
+		// The response describes the list as it was before the
+		// modification, so the version it produces is the next one.
+		currentVersion++
+		logChanges(prefixListID, currentVersion, updateInput.AddEntries, updateInput.RemoveEntries)
+		printChanges(prefixListID, currentVersion, updateInput.AddEntries, updateInput.RemoveEntries)
+		if !jsonOutput() {
+			fmt.Printf("Updated prefix list with ID: %s\n", prefixListID)
+		}
+		printProgress(batch, numRequests, i+1, max(endAdd, endRemove))
 
 		// Wait for the prefix list to be ready for the next modification
-		waitForPrefixListReady(svc, prefixListID)
+		if opts.noWait {
+			continue
+		}
+		if err := waitForPrefixListReady(svc, prefixListID, false); err != nil {
+			return fail(err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fail(errors.Join(errs...))
+	}
+	if opts.autoCreateTags && (len(toAdd) > 0 || len(toRemove) > 0) {
+		if err := tagModified(svc, prefixListID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// peakEntries returns the most entries a list holding current entries
+// reaches while added entries are added and removed ones removed, batch
+// entries at a time.
+func peakEntries(current, added, removed, batch int) int {
+	peak := current
+	for i := 0; i < added || i < removed; i += batch {
+		current += min(batch, max(added-i, 0)) - min(batch, max(removed-i, 0))
+		peak = max(peak, current)
+	}
+	return peak
+}
+
+// ensureCapacity raises the list's MaxEntries so that it can hold needed
+// entries, or fails if -no-auto-expand-max-entries is set.
+func ensureCapacity(svc *ec2.Client, prefixListID string, needed int) error {
+	pl, err := describePrefixList(svc, prefixListID)
+	if err != nil {
+		return err
+	}
+	maxEntries := int(aws.ToInt32(pl.MaxEntries))
+	if needed <= maxEntries {
+		return nil
+	}
+	if opts.noAutoExpand {
+		return fmt.Errorf("the update would require %d entries but the list's MaxEntries is %d; raise MaxEntries or remove -no-auto-expand-max-entries", needed, maxEntries)
+	}
+
+	newMax := maxEntriesWithHeadroom(needed)
+	log.Printf("Expanding MaxEntries of %s from %d to %d", prefixListID, maxEntries, newMax)
+	// MaxEntries cannot be changed in the same request as the entries.
+	modifyInput := &ec2.ModifyManagedPrefixListInput{
+		PrefixListId: aws.String(prefixListID),
+		MaxEntries:   aws.Int32(int32(newMax)),
+	}
+	if _, err := svc.ModifyManagedPrefixList(context.TODO(), modifyInput); err != nil {
+		return fmt.Errorf("failed to expand MaxEntries: %w", err)
+	}
+	return waitForPrefixListReady(svc, prefixListID, false)
+}
+
+// rollbackPrefixList restores the list to version after an update failed
+// with cause, and returns cause along with any error from the restore.
+func rollbackPrefixList(svc *ec2.Client, prefixListID string, version int64, cause error) error {
+	// A list that is still being modified cannot be restored.
+	if err := waitForPrefixListReady(svc, prefixListID, false); err != nil {
+		return errors.Join(cause, fmt.Errorf("rollback failed: %w", err))
+	}
+	currentVersion, err := getCurrentVersion(svc, prefixListID)
+	if err != nil {
+		return errors.Join(cause, fmt.Errorf("rollback failed: %w", err))
+	}
+	if currentVersion == version {
+		log.Printf("Prefix list %s was not changed, nothing to roll back", prefixListID)
+		return cause
+	}
+
+	restoreInput := &ec2.RestoreManagedPrefixListVersionInput{
+		PrefixListId:    aws.String(prefixListID),
+		PreviousVersion: aws.Int64(version),
+		CurrentVersion:  aws.Int64(currentVersion),
+	}
+	if _, err := svc.RestoreManagedPrefixListVersion(context.TODO(), restoreInput); err != nil {
+		return errors.Join(cause, fmt.Errorf("rollback failed: %w", err))
+	}
+	// The restore is waited on even with -no-wait, as only its outcome
+	// tells whether the rollback succeeded.
+	if err := waitForPrefixListReady(svc, prefixListID, true); err != nil {
+		return errors.Join(cause, fmt.Errorf("rollback failed: %w", err))
+	}
+	log.Printf("Rolled back prefix list %s to version %d", prefixListID, version)
+	return cause
+}
+
+// getPrefixListEntries returns the CIDRs currently in a prefix list,
+// following pagination.
+func getPrefixListEntries(svc *ec2.Client, prefixListID string) ([]string, error) {
+	return getPrefixListEntriesAtVersion(svc, prefixListID, 0)
+}
+
+// getPrefixListEntriesAtVersion returns the CIDRs a prefix list held at the
+// given version. A version of 0 means the current version.
+func getPrefixListEntriesAtVersion(svc *ec2.Client, prefixListID string, version int64) ([]string, error) {
+	entries, err := listPrefixListEntries(svc, prefixListID, version)
+	if err != nil {
+		return nil, err
+	}
+	cidrs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		cidrs = append(cidrs, *entry.Cidr)
+	}
+	return cidrs, nil
+}
+
+// listPrefixListEntries returns the full entries, including descriptions, a
+// prefix list held at the given version. A version of 0 means the current
+// version.
+//
+// With -local-cache-dir, entries are cached per list and version, so a
+// version that has been fetched once costs only a version lookup.
+func listPrefixListEntries(svc *ec2.Client, prefixListID string, version int64) ([]types.PrefixListEntry, error) {
+	if opts.cacheDir != "" {
+		if version == 0 {
+			var err error
+			version, err = getCurrentVersion(svc, prefixListID)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if entries, ok := readCachedEntries(prefixListID, version); ok {
+			return entries, nil
+		}
+	}
+
+	entriesInput := &ec2.GetManagedPrefixListEntriesInput{
+		PrefixListId: aws.String(prefixListID),
+	}
+	if version > 0 {
+		entriesInput.TargetVersion = aws.Int64(version)
+	}
+	var entries []types.PrefixListEntry
+	paginator := ec2.NewGetManagedPrefixListEntriesPaginator(svc, entriesInput)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get prefix list entries: %w", err)
+		}
+		entries = append(entries, page.Entries...)
+	}
+
+	if opts.cacheDir != "" {
+		writeCachedEntries(prefixListID, version, entries)
+	}
+	return entries, nil
+}
+
+// planChanges returns the entries to add to a list holding current so that
+// it matches desired, and the CIDRs to remove from it. With
+// -entry-description-prefix, only entries whose description carries the
+// prefix are considered managed by the tool and removed.
+func planChanges(current []types.PrefixListEntry, desired []prefixEntry) (toAdd []prefixEntry, toRemove []string) {
+	var all, managed []string
+	for _, entry := range current {
+		all = append(all, aws.ToString(entry.Cidr))
+		if strings.HasPrefix(aws.ToString(entry.Description), opts.descriptionPrefix) {
+			managed = append(managed, aws.ToString(entry.Cidr))
+		}
+	}
+
+	// Keep the first entry for a CIDR, whose description is the one used.
+	byCIDR := make(map[string]prefixEntry, len(desired))
+	for _, entry := range desired {
+		if _, ok := byCIDR[entry.CIDR]; !ok {
+			byCIDR[entry.CIDR] = entry
+		}
+	}
+
+	addCIDRs, _ := diffEntries(all, cidrsOf(desired))
+	_, toRemove = diffEntries(managed, cidrsOf(desired))
+	for _, cidr := range addCIDRs {
+		toAdd = append(toAdd, byCIDR[cidr])
+	}
+	return toAdd, toRemove
+}
+
+// maxDescriptionLength is the longest entry description EC2 accepts.
+const maxDescriptionLength = 255
+
+// addPrefixListEntry converts an input entry for the EC2 API, leaving out an
+// empty description. With -entry-ttl the expiry time is appended to the
+// description, after truncating the rest to -max-description-length.
+func addPrefixListEntry(entry prefixEntry) types.AddPrefixListEntry {
+	add := types.AddPrefixListEntry{Cidr: aws.String(entry.CIDR)}
+	limit := opts.maxDescriptionLen
+	var expiry string
+	if opts.entryTTL > 0 {
+		expiry = expiresAtPrefix + time.Now().Add(opts.entryTTL).UTC().Format(time.RFC3339)
+		limit -= len(expiry) + 1
 	}
+	description := strings.TrimSpace(truncateDescription(entry.CIDR, entry.Description, limit) + " " + expiry)
+	if description != "" {
+		add.Description = aws.String(description)
+	}
+	return add
+}
+
+// truncateDescription shortens description to at most limit characters,
+// ending it with ... when there is room, and logs a warning when it does.
+func truncateDescription(cidr, description string, limit int) string {
+	runes := []rune(description)
+	if len(runes) <= limit {
+		return description
+	}
+	log.Printf("Warning: truncating the description of %s to %d characters", cidr, max(limit, 0))
+	switch {
+	case limit <= 0:
+		return ""
+	case limit <= 3:
+		return string(runes[:limit])
+	default:
+		return string(runes[:limit-3]) + "..."
+	}
+}
+
+// diffEntries returns the CIDRs in desired that are missing from current,
+// and the CIDRs in current that are not in desired.
+func diffEntries(current, desired []string) (toAdd, toRemove []string) {
+	currentSet := make(map[string]bool, len(current))
+	for _, cidr := range current {
+		currentSet[cidr] = true
+	}
+	desiredSet := make(map[string]bool, len(desired))
+	for _, cidr := range desired {
+		desiredSet[cidr] = true
+		if !currentSet[cidr] {
+			toAdd = append(toAdd, cidr)
+		}
+	}
+	for _, cidr := range current {
+		if !desiredSet[cidr] {
+			toRemove = append(toRemove, cidr)
+		}
+	}
+	return toAdd, toRemove
+}
+
+func deletePrefixList(svc *ec2.Client, prefixListID string) error {
+	deleteInput := &ec2.DeleteManagedPrefixListInput{
+		PrefixListId: aws.String(prefixListID),
+	}
+	m := newOperationReport("delete")
+	m.prefixListID = prefixListID
+	m.resolve(svc) // The list cannot be described once it is gone.
+	_, err := svc.DeleteManagedPrefixList(context.TODO(), deleteInput)
+	reportOperation(svc, m, err)
+	if err != nil {
+		return fmt.Errorf("failed to delete prefix list: %w", err)
+	}
+	if !jsonOutput() {
+		fmt.Printf("Deleted prefix list with ID: %s\n", prefixListID)
+	}
+	return nil
 }
 
-func getCurrentVersion(svc *ec2.Client, prefixListID string) int64 {
+func getCurrentVersion(svc *ec2.Client, prefixListID string) (int64, error) {
 	describeInput := &ec2.DescribeManagedPrefixListsInput{
 		PrefixListIds: []string{prefixListID},
 	}
 	describeResult, err := svc.DescribeManagedPrefixLists(context.TODO(), describeInput)
 	if err != nil {
-		log.Fatalf("Failed to describe prefix list: %v", err)
+		return 0, fmt.Errorf("failed to describe prefix list: %w", err)
+	}
+	return *describeResult.PrefixLists[0].Version, nil
+}
+
+// waitForPrefixLists waits until the named lists, or the list with the given
+// ID, are no longer being modified.
+func waitForPrefixLists(svc *ec2.Client, name, prefixListID string) error {
+	prefixLists, err := resolvePrefixLists(svc, name, prefixListID)
+	if err != nil {
+		return err
 	}
-	return *describeResult.PrefixLists[0].Version
+	for _, pl := range prefixLists {
+		if err := waitForPrefixListReady(svc, aws.ToString(pl.PrefixListId), false); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func waitForPrefixListReady(svc *ec2.Client, prefixListID string) {
+// waitForPrefixListReady polls until the list is no longer in an
+// -in-progress state. Restores, as started by -rollback-on-error, can take
+// longer than creates and modifies, so they are waited on for up to
+// -restore-wait-timeout rather than -wait-timeout, and a restore that fails
+// while being waited on is reported as an error. With expectRestore, the
+// caller has just started a restore, so restore-failed is an error even if
+// the restore failed before the first poll saw it in progress.
+func waitForPrefixListReady(svc *ec2.Client, prefixListID string, expectRestore bool) error {
+	throttled := 0
+	restoring := expectRestore
+	start := time.Now()
 	for {
 		describeInput := &ec2.DescribeManagedPrefixListsInput{
 			PrefixListIds: []string{prefixListID},
 		}
 		describeResult, err := svc.DescribeManagedPrefixLists(context.TODO(), describeInput)
 		if err != nil {
-			log.Fatalf("Failed to describe prefix list: %v", err)
+			// The SDK has already retried this call; keep polling through
+			// sustained throttling for up to -retries more rounds.
+			if isThrottlingError(err) && throttled < opts.retries {
+				throttled++
+				log.Printf("Throttled while waiting for prefix list %s, retrying (%d/%d)", prefixListID, throttled, opts.retries)
+				time.Sleep(time.Duration(throttled) * 5 * time.Second)
+				continue
+			}
+			return fmt.Errorf("failed to describe prefix list: %w", err)
 		}
 		log.Printf("Prefix list state: %s\n", describeResult.PrefixLists[0].State)
 
 		currentState := string(describeResult.PrefixLists[0].State)
 
+		if restoring && describeResult.PrefixLists[0].State == types.PrefixListStateRestoreFailed {
+			reason := aws.ToString(describeResult.PrefixLists[0].StateMessage)
+			return fmt.Errorf("failed to restore prefix list %s: %s", prefixListID, reason)
+		}
 		if len(describeResult.PrefixLists) > 0 && !strings.Contains(currentState, "-in-progress") {
-			break
+			return nil
+		}
+
+		timeout := opts.waitTimeout
+		if describeResult.PrefixLists[0].State == types.PrefixListStateRestoreInProgress {
+			restoring = true
+			timeout = opts.restoreWaitTimeout
+		}
+		if time.Since(start) > timeout {
+			return fmt.Errorf("timed out after %s waiting for prefix list %s in state %s", timeout, prefixListID, currentState)
 		}
 
 		time.Sleep(5 * time.Second) // Wait for 5 seconds before checking again
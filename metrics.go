@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// metricsClient publishes operation metrics to CloudWatch. It is nil when
+// -no-cloudwatch is set.
+var metricsClient *cloudwatch.Client
+
+// publishMetrics sends the outcome of an operation to CloudWatch under
+// -cloudwatch-namespace.
+func publishMetrics(record operationRecord) {
+	success := 1.0
+	if !record.Success {
+		success = 0
+	}
+	dimensions := []cwtypes.Dimension{
+		{Name: aws.String("PrefixListName"), Value: aws.String(record.PrefixListName)},
+		{Name: aws.String("AddressFamily"), Value: aws.String(record.AddressFamily)},
+	}
+	datum := func(name string, value float64, unit cwtypes.StandardUnit) cwtypes.MetricDatum {
+		return cwtypes.MetricDatum{
+			MetricName: aws.String(name),
+			Dimensions: dimensions,
+			Value:      aws.Float64(value),
+			Unit:       unit,
+		}
+	}
+
+	putInput := &cloudwatch.PutMetricDataInput{
+		Namespace: aws.String(opts.cloudwatchNamespace),
+		MetricData: []cwtypes.MetricDatum{
+			datum("EntriesAdded", float64(record.EntriesAdded), cwtypes.StandardUnitCount),
+			datum("EntriesRemoved", float64(record.EntriesRemoved), cwtypes.StandardUnitCount),
+			datum("OperationDurationMs", float64(record.DurationMs), cwtypes.StandardUnitMilliseconds),
+			datum("OperationSuccess", success, cwtypes.StandardUnitNone),
+		},
+	}
+	if record.EntriesAfter != nil {
+		putInput.MetricData = append(putInput.MetricData,
+			datum("EntryCount", float64(*record.EntriesAfter), cwtypes.StandardUnitCount))
+	}
+	if _, err := metricsClient.PutMetricData(context.TODO(), putInput); err != nil {
+		log.Printf("Warning: failed to publish CloudWatch metrics: %v", err)
+	}
+}
+
+// putEntryCountAlarm creates or updates the alarm "<name>-entry-count" on
+// the EntryCount metric of a prefix list. The alarm fires when the count
+// falls below -alarm-min-entries or exceeds -alarm-max-entries; a limit of 0
+// is not checked. The metric is only published when the list is changed,
+// so periods without data leave the alarm in its current state. With
+// -sns-topic-arn set, the topic is notified of alarm state changes.
+func putEntryCountAlarm(record operationRecord) {
+	dimensions := []cwtypes.Dimension{
+		{Name: aws.String("PrefixListName"), Value: aws.String(record.PrefixListName)},
+		{Name: aws.String("AddressFamily"), Value: aws.String(record.AddressFamily)},
+	}
+	query := func(id, stat string) cwtypes.MetricDataQuery {
+		return cwtypes.MetricDataQuery{
+			Id: aws.String(id),
+			MetricStat: &cwtypes.MetricStat{
+				Metric: &cwtypes.Metric{
+					Namespace:  aws.String(opts.cloudwatchNamespace),
+					MetricName: aws.String("EntryCount"),
+					Dimensions: dimensions,
+				},
+				Period: aws.Int32(300),
+				Stat:   aws.String(stat),
+			},
+			ReturnData: aws.Bool(false),
+		}
+	}
+
+	var conditions []string
+	var descriptions []string
+	if opts.alarmMinEntries > 0 {
+		conditions = append(conditions, fmt.Sprintf("low < %d", opts.alarmMinEntries))
+		descriptions = append(descriptions, fmt.Sprintf("below %d", opts.alarmMinEntries))
+	}
+	if opts.alarmMaxEntries > 0 {
+		conditions = append(conditions, fmt.Sprintf("high > %d", opts.alarmMaxEntries))
+		descriptions = append(descriptions, fmt.Sprintf("above %d", opts.alarmMaxEntries))
+	}
+
+	name := record.PrefixListName + "-entry-count"
+	input := &cloudwatch.PutMetricAlarmInput{
+		AlarmName: aws.String(name),
+		AlarmDescription: aws.String(fmt.Sprintf("Entry count of prefix list %s (%s) is %s",
+			record.PrefixListName, record.AddressFamily, strings.Join(descriptions, " or "))),
+		Metrics: []cwtypes.MetricDataQuery{
+			query("low", "Minimum"),
+			query("high", "Maximum"),
+			{
+				Id:         aws.String("breach"),
+				Expression: aws.String(fmt.Sprintf("IF(%s, 1, 0)", strings.Join(conditions, " || "))),
+				Label:      aws.String("EntryCountOutOfRange"),
+				ReturnData: aws.Bool(true),
+			},
+		},
+		ComparisonOperator: cwtypes.ComparisonOperatorGreaterThanOrEqualToThreshold,
+		Threshold:          aws.Float64(1),
+		EvaluationPeriods:  aws.Int32(1),
+		TreatMissingData:   aws.String("ignore"),
+	}
+	if opts.snsTopicARN != "" {
+		input.AlarmActions = []string{opts.snsTopicARN}
+		input.OKActions = []string{opts.snsTopicARN}
+	}
+	if _, err := metricsClient.PutMetricAlarm(context.TODO(), input); err != nil {
+		log.Printf("Warning: failed to put CloudWatch alarm %s: %v", name, err)
+	}
+}
+
+// writeMetricsFile writes the operations of the run in the Prometheus text
+// format, for the node_exporter textfile collector. When a list is operated
+// on more than once in a run, its last operation wins. The file is replaced
+// atomically, so the collector never reads it half written.
+func writeMetricsFile(path string, records []operationRecord) error {
+	type sample struct {
+		labels string
+		value  float64
+	}
+	metrics := []struct {
+		name, help, kind string
+		samples          []sample
+	}{
+		{name: "prefix_list_entries_total", help: "Entries in the prefix list after the operation.", kind: "gauge"},
+		{name: "prefix_list_operation_duration_seconds", help: "Duration of the last operation of each action on the prefix list.", kind: "gauge"},
+		{name: "prefix_list_operation_success", help: "Whether the last operation on the prefix list succeeded.", kind: "gauge"},
+	}
+	// set records value for labels in metric i, replacing an earlier sample
+	// with the same labels.
+	set := func(i int, labels string, value float64) {
+		for j, s := range metrics[i].samples {
+			if s.labels == labels {
+				metrics[i].samples[j].value = value
+				return
+			}
+		}
+		metrics[i].samples = append(metrics[i].samples, sample{labels, value})
+	}
+	for _, r := range records {
+		list := fmt.Sprintf(`name="%s",family="%s"`, promLabel(r.PrefixListName), promLabel(strings.ToLower(r.AddressFamily)))
+		if r.EntriesAfter != nil {
+			set(0, list, float64(*r.EntriesAfter))
+		}
+		set(1, fmt.Sprintf(`action="%s",%s`, promLabel(r.Action), list), float64(r.DurationMs)/1000)
+		success := 0.0
+		if r.Success {
+			success = 1
+		}
+		set(2, list, success)
+	}
+
+	var b strings.Builder
+	for _, m := range metrics {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, s := range m.samples {
+			fmt.Fprintf(&b, "%s{%s} %s\n", m.name, s.labels, strconv.FormatFloat(s.value, 'g', -1, 64))
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(b.String()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// promLabel escapes a Prometheus label value.
+func promLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
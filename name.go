@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// templateVars collects repeated Key=Value flags into the variables available
+// to -prefix-list-name-template.
+type templateVars map[string]string
+
+func (v templateVars) String() string {
+	var pairs []string
+	for key, val := range v {
+		pairs = append(pairs, key+"="+val)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (v templateVars) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected Key=Value, got %q", value)
+	}
+	v[key] = val
+	return nil
+}
+
+// renderName executes the name template text with vars. Referencing a
+// variable that was not passed with -var is an error rather than an empty
+// string, so a missing flag cannot produce a name like "-team-allowlist".
+func renderName(text string, vars templateVars) (string, error) {
+	tmpl, err := template.New("name").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid name template: %w", err)
+	}
+	var name strings.Builder
+	if err := tmpl.Execute(&name, map[string]string(vars)); err != nil {
+		return "", fmt.Errorf("failed to render name template: %w", err)
+	}
+	if name.Len() == 0 {
+		return "", fmt.Errorf("name template %q rendered an empty name", text)
+	}
+	return name.String(), nil
+}
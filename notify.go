@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+)
+
+// notifyClient publishes operation results to -sns-topic-arn. It is nil
+// when no topic is set.
+var notifyClient *sns.Client
+
+// publishNotification sends the record of an operation to -sns-topic-arn
+// as JSON.
+func publishNotification(record operationRecord) {
+	body, _ := json.Marshal(record)
+	publishInput := &sns.PublishInput{
+		TopicArn: aws.String(opts.snsTopicARN),
+		Message:  aws.String(string(body)),
+	}
+	if _, err := notifyClient.Publish(context.TODO(), publishInput); err != nil {
+		log.Printf("Warning: failed to publish SNS notification: %v", err)
+	}
+}
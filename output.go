@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/netip"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+const (
+	ansiReset = "\033[0m"
+	ansiRed   = "\033[31m"
+	ansiGreen = "\033[32m"
+	ansiCyan  = "\033[36m"
+)
+
+// colorize wraps s in the given ANSI color when color output is enabled.
+func colorize(color, s string) string {
+	if !opts.color {
+		return s
+	}
+	return color + s + ansiReset
+}
+
+// prefixListSummary is the printable form of a prefix list. EntryCount is
+// only set when the entries were fetched.
+type prefixListSummary struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	AddressFamily string `json:"addressFamily"`
+	State         string `json:"state"`
+	Version       int64  `json:"version"`
+	MaxEntries    int32  `json:"maxEntries"`
+	EntryCount    *int   `json:"entryCount,omitempty"`
+}
+
+// describedEntry is the printable form of a prefix list entry. The version
+// fields are only filled in for describe -verbose.
+type describedEntry struct {
+	PrefixList            string `json:"prefixList"`
+	CIDR                  string `json:"cidr"`
+	Description           string `json:"description,omitempty"`
+	AddedInVersion        int64  `json:"addedInVersion,omitempty"`
+	AddedInCurrentVersion bool   `json:"addedInCurrentVersion,omitempty"`
+}
+
+func summarizePrefixLists(prefixLists []types.ManagedPrefixList) []prefixListSummary {
+	summaries := make([]prefixListSummary, 0, len(prefixLists))
+	for _, pl := range prefixLists {
+		summaries = append(summaries, prefixListSummary{
+			ID:            aws.ToString(pl.PrefixListId),
+			Name:          aws.ToString(pl.PrefixListName),
+			AddressFamily: aws.ToString(pl.AddressFamily),
+			State:         string(pl.State),
+			Version:       aws.ToInt64(pl.Version),
+			MaxEntries:    aws.ToInt32(pl.MaxEntries),
+		})
+	}
+	return summaries
+}
+
+// newTableWriter returns a writer that aligns tab-separated columns for
+// -output table. Callers must Flush it.
+func newTableWriter() *tabwriter.Writer {
+	return tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+}
+
+// jsonOutput reports whether -output asks for JSON, as an array or as JSON
+// lines.
+func jsonOutput() bool {
+	return opts.output == "json" || opts.output == "jsonlines"
+}
+
+// printJSON writes v as indented JSON to stdout. With -output jsonlines a
+// slice is written one compact element per line instead.
+func printJSON(v interface{}) {
+	if opts.output == "jsonlines" {
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice {
+			for i := range rv.Len() {
+				out, _ := json.Marshal(rv.Index(i).Interface())
+				fmt.Println(string(out))
+			}
+			return
+		}
+		out, _ := json.Marshal(v)
+		fmt.Println(string(out))
+		return
+	}
+	out, _ := json.MarshalIndent(v, "", "  ")
+	fmt.Println(string(out))
+}
+
+// entryChange is one entry added to or removed from a list, as printed with
+// -output jsonlines.
+type entryChange struct {
+	Action       string `json:"action"`
+	CIDR         string `json:"cidr"`
+	PrefixListID string `json:"prefixListId"`
+	Version      int64  `json:"version"`
+}
+
+// printChanges writes one line per added and removed entry with -output
+// jsonlines. version is the list version the change produced.
+func printChanges(prefixListID string, version int64, added []types.AddPrefixListEntry, removed []types.RemovePrefixListEntry) {
+	if opts.output != "jsonlines" {
+		return
+	}
+	var changes []entryChange
+	for _, entry := range added {
+		changes = append(changes, entryChange{"add", aws.ToString(entry.Cidr), prefixListID, version})
+	}
+	for _, entry := range removed {
+		changes = append(changes, entryChange{"remove", aws.ToString(entry.Cidr), prefixListID, version})
+	}
+	printJSON(changes)
+}
+
+// printProgress reports the completion of a single batch. Entry numbers are
+// 1-based and inclusive.
+func printProgress(batch, total, firstEntry, lastEntry int) {
+	// JSON lines output reports each entry through printChanges instead.
+	if opts.quiet || opts.output == "jsonlines" {
+		return
+	}
+	if opts.output == "json" {
+		out, _ := json.Marshal(struct {
+			Type  string `json:"type"`
+			Batch int    `json:"batch"`
+			Total int    `json:"total"`
+		}{"progress", batch, total})
+		fmt.Println(string(out))
+		return
+	}
+	counter := colorize(ansiCyan, fmt.Sprintf("[%d/%d]", batch, total))
+	fmt.Printf("%s Processed batch %d of %d (entries %d-%d)\n", counter, batch, total, firstEntry, lastEntry)
+}
+
+// limitResults returns the first -max-results items, logging a notice when
+// that leaves some out. kind names the items in the notice.
+func limitResults[T any](items []T, kind string) []T {
+	if opts.maxResults == 0 || len(items) <= opts.maxResults {
+		return items
+	}
+	log.Printf("Showing the first %d of %d %s (-max-results)", opts.maxResults, len(items), kind)
+	return items[:opts.maxResults]
+}
+
+// printPrefixLists writes one tab-separated line per prefix list, an aligned
+// table with -output table, or a JSON array with -output json.
+func printPrefixLists(summaries []prefixListSummary) {
+	if jsonOutput() {
+		printJSON(summaries)
+		return
+	}
+
+	var w io.Writer = os.Stdout
+	var tw *tabwriter.Writer
+	if opts.output == "table" {
+		tw = newTableWriter()
+		w = tw
+		fmt.Fprintln(w, "ID\tNAME\tADDRESS FAMILY\tSTATE\tVERSION\tMAX ENTRIES\tENTRY COUNT")
+	}
+	for _, s := range summaries {
+		entryCount := "-"
+		if s.EntryCount != nil {
+			entryCount = fmt.Sprint(*s.EntryCount)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%s\n", s.ID, s.Name, s.AddressFamily, s.State, s.Version, s.MaxEntries, entryCount)
+	}
+	if tw != nil {
+		tw.Flush()
+	}
+}
+
+// printEntries writes one line per entry, an aligned table with -output
+// table, or a JSON array with -output json.
+func printEntries(entries []describedEntry) {
+	switch opts.output {
+	case "json", "jsonlines":
+		if entries == nil {
+			entries = []describedEntry{}
+		}
+		printJSON(entries)
+	case "table":
+		w := newTableWriter()
+		if opts.verbose {
+			fmt.Fprintln(w, "PREFIX LIST\tCIDR\tDESCRIPTION\tADDED IN VERSION")
+		} else {
+			fmt.Fprintln(w, "PREFIX LIST\tCIDR\tDESCRIPTION")
+		}
+		for _, e := range entries {
+			if opts.verbose {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", e.PrefixList, e.CIDR, e.Description, addedIn(e))
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", e.PrefixList, e.CIDR, e.Description)
+		}
+		w.Flush()
+	default:
+		for _, e := range entries {
+			if opts.verbose {
+				fmt.Printf("%s\t%s\t%s\t%s\n", e.PrefixList, e.CIDR, e.Description, addedIn(e))
+				continue
+			}
+			fmt.Printf("%s\t%s\t%s\n", e.PrefixList, e.CIDR, e.Description)
+		}
+	}
+}
+
+// addedIn formats the version an entry was added in for describe -verbose.
+func addedIn(e describedEntry) string {
+	if e.AddedInVersion == 0 {
+		return "unknown"
+	}
+	if e.AddedInCurrentVersion {
+		return fmt.Sprintf("%d (current)", e.AddedInVersion)
+	}
+	return fmt.Sprint(e.AddedInVersion)
+}
+
+// writeEntriesFile writes the CIDRs to path, one per line, sorted by address
+// and then prefix length.
+func writeEntriesFile(path string, cidrs []string) error {
+	sorted := slices.Clone(cidrs)
+	slices.SortFunc(sorted, compareCIDRs)
+
+	var b strings.Builder
+	for _, cidr := range sorted {
+		b.WriteString(cidr)
+		b.WriteByte('\n')
+	}
+	if _, err := writeOutputFile(path, []byte(b.String()), os.O_TRUNC); err != nil {
+		return fmt.Errorf("failed to write entries file: %w", err)
+	}
+	return nil
+}
+
+// writeOutputFile writes data to path, truncating or appending to it as mode
+// (os.O_TRUNC or os.O_APPEND) says, and returns the path written. With
+// -compress-output the data is gzipped and .gz is appended to the path;
+// appended gzip streams still read back as one file.
+func writeOutputFile(path string, data []byte, mode int) (string, error) {
+	if opts.compressOutput {
+		var b bytes.Buffer
+		gz := gzip.NewWriter(&b)
+		gz.Write(data)
+		if err := gz.Close(); err != nil {
+			return "", err
+		}
+		data = b.Bytes()
+		path += ".gz"
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|mode, 0o644)
+	if err != nil {
+		return "", err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return "", err
+	}
+	return path, file.Close()
+}
+
+// compareCIDRs orders CIDRs by address and then prefix length, falling back
+// to string order for anything that does not parse.
+func compareCIDRs(a, b string) int {
+	pa, errA := netip.ParsePrefix(a)
+	pb, errB := netip.ParsePrefix(b)
+	if errA != nil || errB != nil {
+		return strings.Compare(a, b)
+	}
+	if c := pa.Addr().Compare(pb.Addr()); c != 0 {
+		return c
+	}
+	return pa.Bits() - pb.Bits()
+}
+
+// untaggedGroup holds the prefix lists without the -group-by-tag tag.
+const untaggedGroup = "untagged"
+
+// prefixListGroup is the prefix lists sharing one value of a tag.
+type prefixListGroup struct {
+	Value       string
+	PrefixLists []prefixListSummary
+}
+
+// groupPrefixLists groups summaries, which match prefixLists one to one, by
+// the value of the tag key. Groups are sorted by value, with untagged lists
+// last.
+func groupPrefixLists(prefixLists []types.ManagedPrefixList, summaries []prefixListSummary, key string) []prefixListGroup {
+	byValue := make(map[string][]prefixListSummary)
+	for i, pl := range prefixLists {
+		value := untaggedGroup
+		for _, tag := range pl.Tags {
+			if aws.ToString(tag.Key) == key {
+				value = redactTagValue(key, aws.ToString(tag.Value))
+			}
+		}
+		byValue[value] = append(byValue[value], summaries[i])
+	}
+
+	var groups []prefixListGroup
+	for value, lists := range byValue {
+		groups = append(groups, prefixListGroup{Value: value, PrefixLists: lists})
+	}
+	slices.SortFunc(groups, func(a, b prefixListGroup) int {
+		if (a.Value == untaggedGroup) != (b.Value == untaggedGroup) {
+			if a.Value == untaggedGroup {
+				return 1
+			}
+			return -1
+		}
+		return strings.Compare(a.Value, b.Value)
+	})
+	return groups
+}
+
+// printPrefixListGroups writes one "value: [id, ...]" line per group, the
+// full table with a leading group column with -output table, or a JSON
+// object of group value to prefix lists with -output json.
+func printPrefixListGroups(groups []prefixListGroup) {
+	switch opts.output {
+	case "json", "jsonlines":
+		byValue := make(map[string][]prefixListSummary, len(groups))
+		for _, g := range groups {
+			byValue[g.Value] = g.PrefixLists
+		}
+		printJSON(byValue)
+	case "table":
+		w := newTableWriter()
+		fmt.Fprintln(w, "GROUP\tID\tNAME\tADDRESS FAMILY\tSTATE\tVERSION\tMAX ENTRIES\tENTRY COUNT")
+		for _, g := range groups {
+			for _, s := range g.PrefixLists {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%d\t%d\n", g.Value, s.ID, s.Name, s.AddressFamily, s.State, s.Version, s.MaxEntries, aws.ToInt(s.EntryCount))
+			}
+		}
+		w.Flush()
+	default:
+		for _, g := range groups {
+			ids := make([]string, 0, len(g.PrefixLists))
+			for _, s := range g.PrefixLists {
+				ids = append(ids, s.ID)
+			}
+			fmt.Printf("%s: [%s]\n", g.Value, strings.Join(ids, ", "))
+		}
+	}
+}
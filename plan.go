@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// changePlan is the content of -output-plan-file: the changes an update
+// would make to each list, and the version each list was at when planned.
+type changePlan struct {
+	CreatedAt   time.Time  `json:"createdAt"`
+	PrefixLists []listPlan `json:"prefixLists"`
+}
+
+type listPlan struct {
+	ID            string        `json:"id"`
+	Name          string        `json:"name"`
+	AddressFamily string        `json:"addressFamily"`
+	Version       int64         `json:"version"`
+	Add           []prefixEntry `json:"add"`
+	Remove        []string      `json:"remove"`
+}
+
+// pendingPlan collects the planned changes when -output-plan-file is set,
+// in which case updates are planned but not applied. It is nil otherwise.
+var pendingPlan *changePlan
+
+// addToPlan records the changes planned for a list in pendingPlan. pl is
+// the list as described before its entries were read.
+func addToPlan(pl *types.ManagedPrefixList, toAdd []prefixEntry, toRemove []string) {
+	p := listPlan{
+		ID:            aws.ToString(pl.PrefixListId),
+		Name:          aws.ToString(pl.PrefixListName),
+		AddressFamily: aws.ToString(pl.AddressFamily),
+		Version:       aws.ToInt64(pl.Version),
+		Add:           toAdd,
+		Remove:        toRemove,
+	}
+	if p.Add == nil {
+		p.Add = []prefixEntry{}
+	}
+	if p.Remove == nil {
+		p.Remove = []string{}
+	}
+	pendingPlan.PrefixLists = append(pendingPlan.PrefixLists, p)
+	log.Printf("Planned update of %s (%s) at version %d: %d to add, %d to remove", p.Name, p.ID, p.Version, len(p.Add), len(p.Remove))
+}
+
+// writePlanFile writes pendingPlan to path, gzipped with -compress-output.
+func writePlanFile(path string) error {
+	data, err := json.MarshalIndent(pendingPlan, "", "  ")
+	if err != nil {
+		return err
+	}
+	path, err = writeOutputFile(path, append(data, '\n'), os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("failed to write plan file: %w", err)
+	}
+	log.Printf("Plan for %d prefix list(s) written to %s", len(pendingPlan.PrefixLists), path)
+	return nil
+}
+
+// applyPlanFile applies the changes in a plan written by -output-plan-file.
+// The source file is not read and the changes are not recomputed, so a list
+// must still be at the version it was planned against; otherwise the plan is
+// stale and the list is left alone.
+func applyPlanFile(svc *ec2.Client, path string) error {
+	file, err := openInput(path)
+	if err != nil {
+		return fmt.Errorf("failed to read plan file: %w", err)
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read plan file: %w", err)
+	}
+	var plan changePlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return fmt.Errorf("failed to parse plan file %s: %w", path, err)
+	}
+	log.Printf("Applying plan from %s created at %s", path, plan.CreatedAt.Format(time.RFC3339))
+
+	var errs []error
+	for _, p := range plan.PrefixLists {
+		if err := applyListPlan(svc, p); err != nil {
+			err = fmt.Errorf("failed to apply plan for %s: %w", p.Name, err)
+			if opts.failFast {
+				return err
+			}
+			log.Print(err)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func applyListPlan(svc *ec2.Client, p listPlan) error {
+	m := newOperationReport("update")
+	if err := waitForPrefixListReady(svc, p.ID, false); err != nil {
+		return err
+	}
+	version, err := getCurrentVersion(svc, p.ID)
+	if err != nil {
+		return err
+	}
+	if version != p.Version {
+		return fmt.Errorf("plan is stale: prefix list %s is at version %d, planned against version %d", p.ID, version, p.Version)
+	}
+	currentEntries, err := listPrefixListEntries(svc, p.ID, 0)
+	if err != nil {
+		return err
+	}
+	if err := applyPrefixListChanges(svc, m, p.ID, currentEntries, p.Add, p.Remove); err != nil {
+		return err
+	}
+	if opts.deleteEmptyAfterUpdate {
+		return deleteIfEmpty(svc, p.ID)
+	}
+	return nil
+}
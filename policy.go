@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// requiredEC2Actions are the EC2 API actions the tool may call.
+var requiredEC2Actions = []string{
+	"ec2:CreateManagedPrefixList",
+	"ec2:ModifyManagedPrefixList",
+	"ec2:DeleteManagedPrefixList",
+	"ec2:RestoreManagedPrefixListVersion",
+	"ec2:DescribeManagedPrefixLists",
+	"ec2:GetManagedPrefixListEntries",
+	"ec2:GetManagedPrefixListAssociations",
+	"ec2:CreateTags",
+}
+
+// printPolicy writes an IAM policy document granting requiredEC2Actions on
+// the given resource ARN.
+func printPolicy(resource string) {
+	type statement struct {
+		Effect   string   `json:"Effect"`
+		Action   []string `json:"Action"`
+		Resource string   `json:"Resource"`
+	}
+	policy := struct {
+		Version   string      `json:"Version"`
+		Statement []statement `json:"Statement"`
+	}{
+		Version: "2012-10-17",
+		Statement: []statement{{
+			Effect:   "Allow",
+			Action:   requiredEC2Actions,
+			Resource: resource,
+		}},
+	}
+	out, _ := json.MarshalIndent(policy, "", "  ")
+	fmt.Println(string(out))
+}
+
+// permissionResult is the simulated decision for one required action.
+type permissionResult struct {
+	Action   string `json:"action"`
+	Decision string `json:"decision"`
+}
+
+// checkPermissions asks the IAM policy simulator whether the caller may
+// perform each of requiredEC2Actions on resource, prints the decisions, and
+// fails if any action is not allowed. The caller needs
+// iam:SimulatePrincipalPolicy for this to work.
+func checkPermissions(cfg aws.Config, resource string) error {
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(context.TODO(), &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return fmt.Errorf("failed to get caller identity: %w", err)
+	}
+	principal := principalARN(aws.ToString(identity.Arn))
+	log.Printf("Simulating permissions for %s", principal)
+
+	simulateInput := &iam.SimulatePrincipalPolicyInput{
+		PolicySourceArn: aws.String(principal),
+		ActionNames:     requiredEC2Actions,
+		ResourceArns:    []string{resource},
+	}
+	var results []permissionResult
+	paginator := iam.NewSimulatePrincipalPolicyPaginator(iam.NewFromConfig(cfg), simulateInput)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return fmt.Errorf("failed to simulate principal policy: %w", err)
+		}
+		for _, r := range page.EvaluationResults {
+			results = append(results, permissionResult{
+				Action:   aws.ToString(r.EvalActionName),
+				Decision: string(r.EvalDecision),
+			})
+		}
+	}
+
+	denied := 0
+	for _, r := range results {
+		if r.Decision != string(iamtypes.PolicyEvaluationDecisionTypeAllowed) {
+			denied++
+		}
+	}
+
+	switch opts.output {
+	case "json", "jsonlines":
+		printJSON(results)
+	case "table":
+		w := newTableWriter()
+		fmt.Fprintln(w, "ACTION\tDECISION")
+		for _, r := range results {
+			fmt.Fprintf(w, "%s\t%s\n", r.Action, r.Decision)
+		}
+		w.Flush()
+	default:
+		for _, r := range results {
+			fmt.Printf("%s\t%s\n", r.Action, r.Decision)
+		}
+	}
+
+	if denied > 0 {
+		return fmt.Errorf("%d of %d required action(s) not allowed", denied, len(results))
+	}
+	return nil
+}
+
+// principalARN converts an STS assumed-role session ARN into the IAM role
+// ARN the policy simulator accepts. Other ARNs are returned unchanged. Role
+// paths are not part of the session ARN, so roles with a path other than /
+// cannot be resolved this way.
+func principalARN(callerARN string) string {
+	parts := strings.SplitN(callerARN, ":", 6)
+	if len(parts) != 6 || parts[2] != "sts" || !strings.HasPrefix(parts[5], "assumed-role/") {
+		return callerARN
+	}
+	role := strings.Split(strings.TrimPrefix(parts[5], "assumed-role/"), "/")[0]
+	return fmt.Sprintf("arn:%s:iam::%s:role/%s", parts[1], parts[4], role)
+}
@@ -0,0 +1,278 @@
+// Package prefixlist creates and updates AWS managed prefix lists in
+// batches, for programs that embed the tool rather than run it. It holds
+// the core of the command's create and update actions without the
+// command-line options layered on top, such as rollback, change logs and
+// reporting.
+package prefixlist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// MaxEntriesPerRequest is the most entries one CreateManagedPrefixList or
+// ModifyManagedPrefixList call can add or remove.
+const MaxEntriesPerRequest = 100
+
+// API is the part of the EC2 client the package uses. *ec2.Client
+// implements it.
+type API interface {
+	CreateManagedPrefixList(ctx context.Context, params *ec2.CreateManagedPrefixListInput, optFns ...func(*ec2.Options)) (*ec2.CreateManagedPrefixListOutput, error)
+	ModifyManagedPrefixList(ctx context.Context, params *ec2.ModifyManagedPrefixListInput, optFns ...func(*ec2.Options)) (*ec2.ModifyManagedPrefixListOutput, error)
+	DescribeManagedPrefixLists(ctx context.Context, params *ec2.DescribeManagedPrefixListsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeManagedPrefixListsOutput, error)
+	GetManagedPrefixListEntries(ctx context.Context, params *ec2.GetManagedPrefixListEntriesInput, optFns ...func(*ec2.Options)) (*ec2.GetManagedPrefixListEntriesOutput, error)
+}
+
+// Entry is one CIDR of a prefix list, with an optional description.
+type Entry struct {
+	CIDR        string
+	Description string
+}
+
+// ProgressFunc is called after each batch of a create or update with the
+// 1-based batch number, the number of batches and the operation, "create"
+// or "update".
+type ProgressFunc func(batch, totalBatches int, operation string)
+
+// ErrExists is returned by CreatePrefixList when a list of the same name
+// already exists.
+var ErrExists = errors.New("prefix list already exists")
+
+// pollInterval is how long to wait between checks of a list's state.
+var pollInterval = 5 * time.Second
+
+// CreatePrefixList creates the named list with entries and returns its ID.
+// The list is created with the first MaxEntriesPerRequest entries and the
+// rest are added one batch at a time, waiting for the list to settle after
+// each. progress, when not nil, is called after every batch.
+func CreatePrefixList(ctx context.Context, client API, name, addressFamily string, entries []Entry, tags []types.Tag, progress ProgressFunc) (string, error) {
+	existing, err := findByName(ctx, client, name)
+	if err != nil {
+		return "", err
+	}
+	if existing != nil {
+		return "", fmt.Errorf("%w: %s (%s)", ErrExists, name, aws.ToString(existing.PrefixListId))
+	}
+
+	first := entries[:min(len(entries), MaxEntriesPerRequest)]
+	// An empty list still takes one request to create.
+	total := max(1, batches(len(entries)))
+	input := &ec2.CreateManagedPrefixListInput{
+		PrefixListName: aws.String(name),
+		AddressFamily:  aws.String(addressFamily),
+		MaxEntries:     aws.Int32(int32(max(1, len(entries)))),
+		Entries:        addEntries(first),
+	}
+	if len(tags) > 0 {
+		input.TagSpecifications = []types.TagSpecification{
+			{ResourceType: types.ResourceTypePrefixList, Tags: tags},
+		}
+	}
+	result, err := client.CreateManagedPrefixList(ctx, input)
+	if err != nil {
+		return "", fmt.Errorf("failed to create prefix list: %w", err)
+	}
+	id := aws.ToString(result.PrefixList.PrefixListId)
+	if err := WaitForPrefixList(ctx, client, id); err != nil {
+		return id, err
+	}
+	report(progress, 1, total, "create")
+
+	rest := entries[len(first):]
+	for i := 0; i < len(rest); i += MaxEntriesPerRequest {
+		batch := rest[i:min(i+MaxEntriesPerRequest, len(rest))]
+		if err := modify(ctx, client, id, addEntries(batch), nil); err != nil {
+			return id, fmt.Errorf("failed to update prefix list (batch %d of %d): %w", i/MaxEntriesPerRequest+2, total, err)
+		}
+		report(progress, i/MaxEntriesPerRequest+2, total, "create")
+	}
+	return id, nil
+}
+
+// UpdatePrefixList makes the list hold exactly entries, adding and removing
+// up to MaxEntriesPerRequest of each per batch and waiting for the list to
+// settle after each. MaxEntries is raised first if the list needs more
+// room. progress, when not nil, is called after every batch.
+func UpdatePrefixList(ctx context.Context, client API, prefixListID string, entries []Entry, progress ProgressFunc) error {
+	current, err := listEntries(ctx, client, prefixListID)
+	if err != nil {
+		return err
+	}
+	desired := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		desired[e.CIDR] = true
+	}
+	have := make(map[string]bool, len(current))
+	var toRemove []types.RemovePrefixListEntry
+	for _, e := range current {
+		have[aws.ToString(e.Cidr)] = true
+		if !desired[aws.ToString(e.Cidr)] {
+			toRemove = append(toRemove, types.RemovePrefixListEntry{Cidr: e.Cidr})
+		}
+	}
+	var toAdd []Entry
+	for _, e := range entries {
+		if !have[e.CIDR] {
+			toAdd = append(toAdd, e)
+			have[e.CIDR] = true
+		}
+	}
+	if len(toAdd) == 0 && len(toRemove) == 0 {
+		return nil
+	}
+
+	if needed := len(current) + len(toAdd); needed > 0 {
+		if err := ensureCapacity(ctx, client, prefixListID, needed); err != nil {
+			return err
+		}
+	}
+
+	adds := addEntries(toAdd)
+	total := batches(max(len(adds), len(toRemove)))
+	for i := 0; i < len(adds) || i < len(toRemove); i += MaxEntriesPerRequest {
+		batch := i/MaxEntriesPerRequest + 1
+		add := adds[min(i, len(adds)):min(i+MaxEntriesPerRequest, len(adds))]
+		remove := toRemove[min(i, len(toRemove)):min(i+MaxEntriesPerRequest, len(toRemove))]
+		if err := modify(ctx, client, prefixListID, add, remove); err != nil {
+			return fmt.Errorf("failed to update prefix list (batch %d of %d): %w", batch, total, err)
+		}
+		report(progress, batch, total, "update")
+	}
+	return nil
+}
+
+// WaitForPrefixList polls until the list is no longer in an -in-progress
+// state, failing if it settles in a failed state.
+func WaitForPrefixList(ctx context.Context, client API, prefixListID string) error {
+	for {
+		pl, err := describe(ctx, client, prefixListID)
+		if err != nil {
+			return err
+		}
+		state := string(pl.State)
+		if strings.HasSuffix(state, "-failed") {
+			return fmt.Errorf("prefix list %s is in state %s: %s", prefixListID, state, aws.ToString(pl.StateMessage))
+		}
+		if !strings.HasSuffix(state, "-in-progress") {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func report(progress ProgressFunc, batch, total int, operation string) {
+	if progress != nil {
+		progress(batch, total, operation)
+	}
+}
+
+func batches(entries int) int {
+	return (entries + MaxEntriesPerRequest - 1) / MaxEntriesPerRequest
+}
+
+func addEntries(entries []Entry) []types.AddPrefixListEntry {
+	adds := make([]types.AddPrefixListEntry, len(entries))
+	for i, e := range entries {
+		adds[i] = types.AddPrefixListEntry{Cidr: aws.String(e.CIDR)}
+		if e.Description != "" {
+			adds[i].Description = aws.String(e.Description)
+		}
+	}
+	return adds
+}
+
+// modify sends one batch against the list's current version and waits for
+// it to be applied.
+func modify(ctx context.Context, client API, prefixListID string, add []types.AddPrefixListEntry, remove []types.RemovePrefixListEntry) error {
+	pl, err := describe(ctx, client, prefixListID)
+	if err != nil {
+		return err
+	}
+	_, err = client.ModifyManagedPrefixList(ctx, &ec2.ModifyManagedPrefixListInput{
+		PrefixListId:   aws.String(prefixListID),
+		CurrentVersion: pl.Version,
+		AddEntries:     add,
+		RemoveEntries:  remove,
+	})
+	if err != nil {
+		return err
+	}
+	return WaitForPrefixList(ctx, client, prefixListID)
+}
+
+// ensureCapacity raises MaxEntries to needed if it is lower. MaxEntries
+// cannot be changed in the same request as the entries.
+func ensureCapacity(ctx context.Context, client API, prefixListID string, needed int) error {
+	pl, err := describe(ctx, client, prefixListID)
+	if err != nil {
+		return err
+	}
+	if int(aws.ToInt32(pl.MaxEntries)) >= needed {
+		return nil
+	}
+	_, err = client.ModifyManagedPrefixList(ctx, &ec2.ModifyManagedPrefixListInput{
+		PrefixListId: aws.String(prefixListID),
+		MaxEntries:   aws.Int32(int32(needed)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to expand MaxEntries: %w", err)
+	}
+	return WaitForPrefixList(ctx, client, prefixListID)
+}
+
+func describe(ctx context.Context, client API, prefixListID string) (*types.ManagedPrefixList, error) {
+	out, err := client.DescribeManagedPrefixLists(ctx, &ec2.DescribeManagedPrefixListsInput{
+		PrefixListIds: []string{prefixListID},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe prefix list: %w", err)
+	}
+	if len(out.PrefixLists) == 0 {
+		return nil, fmt.Errorf("prefix list %s not found", prefixListID)
+	}
+	return &out.PrefixLists[0], nil
+}
+
+func findByName(ctx context.Context, client API, name string) (*types.ManagedPrefixList, error) {
+	paginator := ec2.NewDescribeManagedPrefixListsPaginator(client, &ec2.DescribeManagedPrefixListsInput{
+		Filters: []types.Filter{{Name: aws.String("prefix-list-name"), Values: []string{name}}},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe prefix lists: %w", err)
+		}
+		for _, pl := range page.PrefixLists {
+			if aws.ToString(pl.PrefixListName) == name {
+				return &pl, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func listEntries(ctx context.Context, client API, prefixListID string) ([]types.PrefixListEntry, error) {
+	var entries []types.PrefixListEntry
+	paginator := ec2.NewGetManagedPrefixListEntriesPaginator(client, &ec2.GetManagedPrefixListEntriesInput{
+		PrefixListId: aws.String(prefixListID),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get prefix list entries: %w", err)
+		}
+		entries = append(entries, page.Entries...)
+	}
+	return entries, nil
+}
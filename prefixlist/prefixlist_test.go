@@ -0,0 +1,143 @@
+package prefixlist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// fakeEC2 keeps one prefix list in memory. Every change is applied at once,
+// so the list is always settled.
+type fakeEC2 struct {
+	list    *types.ManagedPrefixList
+	entries []types.PrefixListEntry
+}
+
+func (f *fakeEC2) CreateManagedPrefixList(_ context.Context, in *ec2.CreateManagedPrefixListInput, _ ...func(*ec2.Options)) (*ec2.CreateManagedPrefixListOutput, error) {
+	f.list = &types.ManagedPrefixList{
+		PrefixListId:   aws.String("pl-test"),
+		PrefixListName: in.PrefixListName,
+		MaxEntries:     in.MaxEntries,
+		Version:        aws.Int64(1),
+		State:          types.PrefixListStateCreateComplete,
+	}
+	for _, e := range in.Entries {
+		f.entries = append(f.entries, types.PrefixListEntry{Cidr: e.Cidr, Description: e.Description})
+	}
+	return &ec2.CreateManagedPrefixListOutput{PrefixList: f.list}, nil
+}
+
+func (f *fakeEC2) ModifyManagedPrefixList(_ context.Context, in *ec2.ModifyManagedPrefixListInput, _ ...func(*ec2.Options)) (*ec2.ModifyManagedPrefixListOutput, error) {
+	if in.MaxEntries != nil {
+		f.list.MaxEntries = in.MaxEntries
+		return &ec2.ModifyManagedPrefixListOutput{PrefixList: f.list}, nil
+	}
+	if aws.ToInt64(in.CurrentVersion) != aws.ToInt64(f.list.Version) {
+		return nil, fmt.Errorf("version mismatch")
+	}
+	for _, r := range in.RemoveEntries {
+		f.entries = slices.DeleteFunc(f.entries, func(e types.PrefixListEntry) bool {
+			return aws.ToString(e.Cidr) == aws.ToString(r.Cidr)
+		})
+	}
+	for _, a := range in.AddEntries {
+		f.entries = append(f.entries, types.PrefixListEntry{Cidr: a.Cidr, Description: a.Description})
+	}
+	if len(f.entries) > int(aws.ToInt32(f.list.MaxEntries)) {
+		return nil, fmt.Errorf("%d entries exceed MaxEntries %d", len(f.entries), aws.ToInt32(f.list.MaxEntries))
+	}
+	f.list.Version = aws.Int64(aws.ToInt64(f.list.Version) + 1)
+	return &ec2.ModifyManagedPrefixListOutput{PrefixList: f.list}, nil
+}
+
+func (f *fakeEC2) DescribeManagedPrefixLists(context.Context, *ec2.DescribeManagedPrefixListsInput, ...func(*ec2.Options)) (*ec2.DescribeManagedPrefixListsOutput, error) {
+	out := &ec2.DescribeManagedPrefixListsOutput{}
+	if f.list != nil {
+		out.PrefixLists = []types.ManagedPrefixList{*f.list}
+	}
+	return out, nil
+}
+
+func (f *fakeEC2) GetManagedPrefixListEntries(context.Context, *ec2.GetManagedPrefixListEntriesInput, ...func(*ec2.Options)) (*ec2.GetManagedPrefixListEntriesOutput, error) {
+	return &ec2.GetManagedPrefixListEntriesOutput{Entries: slices.Clone(f.entries)}, nil
+}
+
+func testEntries(from, to int) []Entry {
+	var entries []Entry
+	for i := from; i < to; i++ {
+		entries = append(entries, Entry{CIDR: fmt.Sprintf("10.%d.%d.0/24", i/256, i%256)})
+	}
+	return entries
+}
+
+type progressCall struct {
+	batch, total int
+	operation    string
+}
+
+func TestCreateAndUpdateReportProgress(t *testing.T) {
+	client := &fakeEC2{}
+	var calls []progressCall
+	progress := func(batch, totalBatches int, operation string) {
+		calls = append(calls, progressCall{batch, totalBatches, operation})
+	}
+
+	id, err := CreatePrefixList(context.Background(), client, "test", "IPv4", testEntries(0, 250), nil, progress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "pl-test" {
+		t.Errorf("id = %q, want pl-test", id)
+	}
+	if len(client.entries) != 250 {
+		t.Errorf("list has %d entries after create, want 250", len(client.entries))
+	}
+	want := []progressCall{{1, 3, "create"}, {2, 3, "create"}, {3, 3, "create"}}
+	if !slices.Equal(calls, want) {
+		t.Errorf("create progress = %v, want %v", calls, want)
+	}
+
+	// Drop the first 150 entries and add 120 new ones: two batches.
+	calls = nil
+	if err := UpdatePrefixList(context.Background(), client, id, testEntries(150, 370), progress); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.entries) != 220 {
+		t.Errorf("list has %d entries after update, want 220", len(client.entries))
+	}
+	want = []progressCall{{1, 2, "update"}, {2, 2, "update"}}
+	if !slices.Equal(calls, want) {
+		t.Errorf("update progress = %v, want %v", calls, want)
+	}
+}
+
+func TestNilProgress(t *testing.T) {
+	client := &fakeEC2{}
+	id, err := CreatePrefixList(context.Background(), client, "test", "IPv4", testEntries(0, 150), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdatePrefixList(context.Background(), client, id, testEntries(0, 10), nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.entries) != 10 {
+		t.Errorf("list has %d entries, want 10", len(client.entries))
+	}
+}
+
+func TestCreateExisting(t *testing.T) {
+	client := &fakeEC2{}
+	if _, err := CreatePrefixList(context.Background(), client, "test", "IPv4", testEntries(0, 1), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	_, err := CreatePrefixList(context.Background(), client, "test", "IPv4", testEntries(0, 1), nil, nil)
+	if !errors.Is(err, ErrExists) {
+		t.Errorf("err = %v, want ErrExists", err)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// regionResult is the outcome of running the action in one region.
+type regionResult struct {
+	region   string
+	output   []byte
+	exitCode int
+	err      error
+}
+
+// runRegions runs the tool once per region, at most parallel at a time, with
+// the same arguments minus -regions and -parallel-regions and AWS_REGION set
+// to the region. {region} in the paths of regionOutputFlags is replaced by
+// the region, so that each region writes its own files. Each region runs in
+// its own process, so state such as locks, caches and report records is
+// never shared between regions. Output is printed region by region once all
+// have finished, and a failure in one region does not stop the others. With
+// JSON output the region headers and the closing count are left out, so
+// stdout holds only what the regions wrote. The highest exit code is
+// returned.
+func runRegions(regions []string, parallel int) int {
+	executable, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to find executable: %v\n", err)
+		return exitFailure
+	}
+	args := stripRegionFlags(os.Args[1:])
+
+	results := make([]regionResult, len(regions))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, region := range regions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			cmd := exec.Command(executable, expandRegionPaths(args, region)...)
+			cmd.Env = append(os.Environ(), "AWS_REGION="+region)
+			var output bytes.Buffer
+			cmd.Stdout = &output
+			cmd.Stderr = &output
+			err := cmd.Run()
+
+			result := regionResult{region: region, output: output.Bytes(), err: err}
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				result.exitCode = exitErr.ExitCode()
+			} else if err != nil {
+				result.exitCode = exitFailure
+			}
+			results[i] = result
+		}()
+	}
+	wg.Wait()
+
+	code := 0
+	failed := 0
+	for _, r := range results {
+		status := colorize(ansiGreen, "succeeded")
+		if r.err != nil {
+			status = colorize(ansiRed, fmt.Sprintf("failed (%v)", r.err))
+			failed++
+		}
+		if !jsonOutput() {
+			fmt.Printf("=== %s: %s ===\n", r.region, status)
+		}
+		os.Stdout.Write(r.output)
+		code = max(code, r.exitCode)
+	}
+	if !jsonOutput() {
+		fmt.Printf("%d of %d region(s) succeeded\n", len(regions)-failed, len(regions))
+	}
+	return code
+}
+
+// stripRegionFlags removes -regions and -parallel-regions, in any of the
+// forms the flag package accepts, from args.
+func stripRegionFlags(args []string) []string {
+	var stripped []string
+	for i := 0; i < len(args); i++ {
+		name, _, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		if !strings.HasPrefix(args[i], "-") || (name != "regions" && name != "parallel-regions") {
+			stripped = append(stripped, args[i])
+			continue
+		}
+		if !hasValue {
+			i++
+		}
+	}
+	return stripped
+}
+
+// regionOutputFlags are the flags naming files or directories a run writes.
+// With -regions their paths must contain {region}, or every region would
+// write the same file.
+var regionOutputFlags = []string{
+	"output-summary-file",
+	"output-metrics-file",
+	"output-entries-file",
+	"output-entries-file-ipv6",
+	"output-plan-file",
+	"output-change-log",
+	"snapshot-dir",
+}
+
+// expandRegionPaths replaces {region} with region in the values of
+// regionOutputFlags in args.
+func expandRegionPaths(args []string, region string) []string {
+	expanded := slices.Clone(args)
+	for i := 0; i < len(expanded); i++ {
+		name, _, hasValue := strings.Cut(strings.TrimLeft(expanded[i], "-"), "=")
+		if !strings.HasPrefix(expanded[i], "-") || !slices.Contains(regionOutputFlags, name) {
+			continue
+		}
+		if !hasValue {
+			i++
+			if i == len(expanded) {
+				break
+			}
+		}
+		expanded[i] = strings.ReplaceAll(expanded[i], "{region}", region)
+	}
+	return expanded
+}
+
+// splitRegions parses the comma-separated -regions value.
+func splitRegions(value string) []string {
+	var regions []string
+	for _, region := range strings.Split(value, ",") {
+		if region = strings.TrimSpace(region); region != "" {
+			regions = append(regions, region)
+		}
+	}
+	return regions
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+// operationReport tracks one create, update or delete of a prefix list so
+// that its outcome can be reported to CloudWatch, SNS and the summary file.
+// The name and address family are looked up from the ID when not known.
+type operationReport struct {
+	action        string
+	prefixListID  string
+	name          string
+	addressFamily string
+	before        *int
+	added         int
+	removed       int
+	start         time.Time
+	startCalls    int64
+}
+
+// operationRecord is the JSON form of a finished operation, as published to
+// SNS and written to -output-summary-file. EntriesBefore is omitted when it
+// is not known.
+type operationRecord struct {
+	Timestamp      time.Time `json:"timestamp"`
+	Action         string    `json:"action"`
+	PrefixListID   string    `json:"prefixListId"`
+	PrefixListName string    `json:"prefixListName"`
+	AddressFamily  string    `json:"addressFamily"`
+	EntriesBefore  *int      `json:"entriesBefore,omitempty"`
+	EntriesAfter   *int      `json:"entriesAfter,omitempty"`
+	EntriesAdded   int       `json:"entriesAdded"`
+	EntriesRemoved int       `json:"entriesRemoved"`
+	APICalls       int64     `json:"apiCalls"`
+	DurationMs     int64     `json:"durationMs"`
+	Version        int64     `json:"version,omitempty"`
+	State          string    `json:"state,omitempty"`
+	Success        bool      `json:"success"`
+	Error          string    `json:"error,omitempty"`
+}
+
+// apiCalls counts the AWS API operations made so far, for the summary file.
+var apiCalls atomic.Int64
+
+// summaryRecords collects the operations of the current run for
+// -output-summary-file and -output-metrics-file. It is nil when neither is
+// written.
+var summaryRecords []operationRecord
+
+// newOperationReport starts tracking an operation.
+func newOperationReport(action string) operationReport {
+	return operationReport{action: action, start: time.Now(), startCalls: apiCalls.Load()}
+}
+
+// reporting reports whether operations are published anywhere.
+func reporting() bool {
+	return metricsClient != nil || notifyClient != nil || opts.webhookURL != "" || summaryRecords != nil
+}
+
+// resolve fills in the name and address family of the prefix list.
+func (m *operationReport) resolve(svc *ec2.Client) {
+	if !reporting() || m.name != "" {
+		return
+	}
+	pl, err := describePrefixList(svc, m.prefixListID)
+	if err != nil {
+		log.Printf("Warning: failed to look up %s for reporting: %v", m.prefixListID, err)
+		return
+	}
+	m.name = aws.ToString(pl.PrefixListName)
+	m.addressFamily = aws.ToString(pl.AddressFamily)
+}
+
+// reportOperation publishes the outcome of an operation to CloudWatch, SNS,
+// the webhook and the summary file, as configured. Failures are logged
+// rather than returned so that reporting never fails an otherwise
+// successful run.
+func reportOperation(svc *ec2.Client, m operationReport, opErr error) {
+	if !reporting() {
+		return
+	}
+	record := operationRecord{
+		Timestamp:      m.start.UTC(),
+		Action:         m.action,
+		EntriesBefore:  m.before,
+		EntriesAdded:   m.added,
+		EntriesRemoved: m.removed,
+		APICalls:       apiCalls.Load() - m.startCalls,
+		DurationMs:     time.Since(m.start).Milliseconds(),
+		Success:        opErr == nil,
+	}
+	m.resolve(svc)
+	record.PrefixListID = m.prefixListID
+	record.PrefixListName = m.name
+	record.AddressFamily = m.addressFamily
+	if opErr != nil {
+		record.Error = opErr.Error()
+	}
+	if m.action == "delete" {
+		if opErr == nil {
+			record.EntriesAfter = aws.Int(0)
+			record.State = "delete-complete"
+		}
+	} else if m.before != nil && opErr == nil {
+		record.EntriesAfter = aws.Int(*m.before + m.added - m.removed)
+	}
+	if m.prefixListID != "" && record.State == "" {
+		if pl, err := describePrefixList(svc, m.prefixListID); err == nil {
+			record.State = string(pl.State)
+			record.Version = aws.ToInt64(pl.Version)
+		}
+	}
+
+	if metricsClient != nil {
+		publishMetrics(record)
+		if opts.cloudwatchAlarm && record.Success && record.Action != "delete" {
+			putEntryCountAlarm(record)
+		}
+	}
+	if notifyClient != nil {
+		publishNotification(record)
+	}
+	if opts.webhookURL != "" {
+		postWebhook(record)
+	}
+	if summaryRecords != nil {
+		summaryRecords = append(summaryRecords, record)
+	}
+}
+
+// writeSummaryFile writes the operations of the run as a JSON array.
+func writeSummaryFile(path string) error {
+	data, err := json.MarshalIndent(summaryRecords, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = writeOutputFile(path, append(data, '\n'), os.O_TRUNC)
+	return err
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// s3Client reads s3:// IP files.
+var s3Client *s3.Client
+
+func isS3URI(filePath string) bool {
+	return strings.HasPrefix(filePath, "s3://")
+}
+
+// fetchS3Object opens the object named by an s3://bucket/key URI. An object
+// stored with Content-Encoding gzip is decompressed, unless its key ends in
+// .gz, in which case openInput decompresses it.
+func fetchS3Object(uri string) (io.ReadCloser, error) {
+	if s3Client == nil {
+		return nil, fmt.Errorf("cannot read %s: no S3 client configured", uri)
+	}
+	bucket, key, ok := strings.Cut(strings.TrimPrefix(uri, "s3://"), "/")
+	if !ok || bucket == "" || key == "" {
+		return nil, fmt.Errorf("invalid S3 URI %s, expected s3://bucket/key", uri)
+	}
+	out, err := s3Client.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", uri, err)
+	}
+	if !strings.EqualFold(aws.ToString(out.ContentEncoding), "gzip") || strings.HasSuffix(key, ".gz") {
+		return out.Body, nil
+	}
+	gz, err := gzip.NewReader(out.Body)
+	if err != nil {
+		out.Body.Close()
+		return nil, fmt.Errorf("failed to decompress %s: %w", uri, err)
+	}
+	return gzipReadCloser{gz, out.Body}, nil
+}
+
+// checkDrift compares every object under prefix in bucket against the
+// prefix list it names: the object's base name without its extensions, so
+// that prefix-lists/office-ipv4.txt holds the entries of office-ipv4.
+// Objects without a matching list are skipped with a warning.
+func checkDrift(svc *ec2.Client, bucket, prefix string) ([]auditResult, error) {
+	var results []auditResult
+	paginator := s3.NewListObjectsV2Paginator(s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list s3://%s/%s: %w", bucket, prefix, err)
+		}
+		for _, object := range page.Contents {
+			key := aws.ToString(object.Key)
+			if strings.HasSuffix(key, "/") {
+				continue
+			}
+			name := strings.TrimSuffix(path.Base(key), ".gz")
+			name = strings.TrimSuffix(name, path.Ext(name))
+
+			pl, err := findPrefixListByName(svc, name)
+			if err != nil {
+				return nil, err
+			}
+			uri := fmt.Sprintf("s3://%s/%s", bucket, key)
+			if pl == nil {
+				log.Printf("No prefix list named %s for %s, skipping", name, uri)
+				continue
+			}
+			result, err := auditPrefixList(svc, *pl, uri)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// runScheduled runs fn at every time matched by the standard five-field cron
+// spec and only returns if the spec is invalid. Runs never overlap, and a
+// failed run is logged without stopping the schedule.
+func runScheduled(spec string, runOnStart bool, fn func() error) error {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return fmt.Errorf("invalid schedule %q: %w", spec, err)
+	}
+
+	run := func() {
+		if err := fn(); err != nil {
+			log.Printf("Scheduled run failed: %v", err)
+		}
+	}
+
+	if runOnStart {
+		run()
+	}
+	for {
+		next := schedule.Next(time.Now())
+		log.Printf("Next run at %s", next.Format(time.RFC3339))
+		time.Sleep(time.Until(next))
+		run()
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// snapshotPrefixList saves the entries a prefix list holds before it is
+// modified to -snapshot-dir, as a JSON IP file that can be fed back to
+// -action update to restore them. Snapshots older than
+// -snapshot-retention-days are then removed.
+func snapshotPrefixList(svc *ec2.Client, prefixListID string, entries []types.PrefixListEntry) error {
+	pl, err := describePrefixList(svc, prefixListID)
+	if err != nil {
+		return err
+	}
+
+	snapshot := make([]prefixEntry, 0, len(entries))
+	for _, entry := range entries {
+		snapshot = append(snapshot, prefixEntry{
+			CIDR:        aws.ToString(entry.Cidr),
+			Description: aws.ToString(entry.Description),
+		})
+	}
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(opts.snapshotDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	name := fmt.Sprintf("%s-%s-v%d-%s.json",
+		aws.ToString(pl.PrefixListName),
+		strings.ToLower(aws.ToString(pl.AddressFamily)),
+		aws.ToInt64(pl.Version),
+		time.Now().UTC().Format("20060102T150405Z"))
+	path, err := writeOutputFile(filepath.Join(opts.snapshotDir, name), data, os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	log.Printf("Saved snapshot of %s to %s", prefixListID, path)
+
+	if opts.snapshotRetentionDays > 0 {
+		pruneSnapshots(time.Now().AddDate(0, 0, -opts.snapshotRetentionDays))
+	}
+	return nil
+}
+
+// snapshotFileName matches the names snapshotPrefixList gives snapshots:
+// <name>-<family>-v<version>-<timestamp>.json, optionally gzipped.
+var snapshotFileName = regexp.MustCompile(`^.+-ipv[46]-v\d+-\d{8}T\d{6}Z\.json(\.gz)?$`)
+
+// pruneSnapshots removes snapshot files last modified before cutoff. Only
+// files named like snapshots are considered, so other files sharing
+// -snapshot-dir are left alone.
+// Failures are logged, as they don't affect the update.
+func pruneSnapshots(cutoff time.Time) {
+	files, err := os.ReadDir(opts.snapshotDir)
+	if err != nil {
+		log.Printf("Failed to read snapshot directory: %v", err)
+		return
+	}
+	for _, f := range files {
+		if f.IsDir() || !snapshotFileName.MatchString(f.Name()) {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		path := filepath.Join(opts.snapshotDir, f.Name())
+		if err := os.Remove(path); err != nil {
+			log.Printf("Failed to remove old snapshot %s: %v", path, err)
+			continue
+		}
+		log.Printf("Removed old snapshot %s", path)
+	}
+}
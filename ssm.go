@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// ssmClient reads ssm:// IP files.
+var ssmClient *ssm.Client
+
+func isSSMURI(filePath string) bool {
+	return strings.HasPrefix(filePath, "ssm://")
+}
+
+// fetchSSMParameter opens the value of the SSM parameter named by an
+// ssm://name URI, decrypting SecureString parameters. Hierarchical names may
+// be written without their leading slash, so ssm://prod/cidrs reads
+// /prod/cidrs. The items of a StringList are returned one per line.
+func fetchSSMParameter(uri string) (io.ReadCloser, error) {
+	if ssmClient == nil {
+		return nil, fmt.Errorf("cannot read %s: no SSM client configured", uri)
+	}
+	name := strings.TrimPrefix(uri, "ssm://")
+	if name == "" {
+		return nil, fmt.Errorf("invalid SSM URI %s, expected ssm://name", uri)
+	}
+	if strings.Contains(name, "/") && !strings.HasPrefix(name, "/") {
+		name = "/" + name
+	}
+	out, err := ssmClient.GetParameter(context.TODO(), &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", uri, err)
+	}
+	value := aws.ToString(out.Parameter.Value)
+	if out.Parameter.Type == ssmtypes.ParameterTypeStringList {
+		value = strings.ReplaceAll(value, ",", "\n")
+	}
+	return io.NopCloser(strings.NewReader(value)), nil
+}
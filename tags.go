@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// tagFlags collects repeated Key=Value flags into EC2 tags.
+type tagFlags []types.Tag
+
+func (t *tagFlags) String() string {
+	var pairs []string
+	for _, tag := range *t {
+		pairs = append(pairs, aws.ToString(tag.Key)+"="+redactTagValue(aws.ToString(tag.Key), aws.ToString(tag.Value)))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (t *tagFlags) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected Key=Value, got %q", value)
+	}
+	*t = append(*t, types.Tag{Key: aws.String(key), Value: aws.String(val)})
+	return nil
+}
+
+// toolName is the CreatedByTool tag value set by -auto-create-tags.
+const toolName = "aws-prefix-list"
+
+// creationTags returns the tags -auto-create-tags adds to a list it creates.
+func creationTags() []types.Tag {
+	return tagsFromMap(map[string]string{
+		"CreatedBy":     operator,
+		"CreatedAt":     time.Now().UTC().Format(time.RFC3339),
+		"CreatedByTool": toolName,
+	})
+}
+
+// tagModified sets the tags -auto-create-tags adds to a list it updates.
+func tagModified(svc *ec2.Client, prefixListID string) error {
+	createTagsInput := &ec2.CreateTagsInput{
+		Resources: []string{prefixListID},
+		Tags: tagsFromMap(map[string]string{
+			"LastModifiedBy": operator,
+			"LastModifiedAt": time.Now().UTC().Format(time.RFC3339),
+		}),
+	}
+	if _, err := svc.CreateTags(context.TODO(), createTagsInput); err != nil {
+		return fmt.Errorf("failed to tag %s: %w", prefixListID, err)
+	}
+	return nil
+}
+
+// redactTagValue returns *** in place of value when the tag key or value
+// matches -hide-sensitive-tag-pattern, so that the value stays out of logs.
+func redactTagValue(key, value string) string {
+	if opts.hideTagPattern != nil && (opts.hideTagPattern.MatchString(key) || opts.hideTagPattern.MatchString(value)) {
+		return "***"
+	}
+	return value
+}
+
+// loadTagsFile reads tags from a JSON file holding either an object of
+// Key: Value pairs or an AWS-style array of {"Key": ..., "Value": ...}.
+func loadTagsFile(path string) ([]types.Tag, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var pairs map[string]string
+	if err := json.Unmarshal(data, &pairs); err == nil {
+		return tagsFromMap(pairs), nil
+	}
+
+	var list []struct {
+		Key   string
+		Value string
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("%s: expected a JSON object or an array of Key/Value objects", path)
+	}
+	tags := make([]types.Tag, 0, len(list))
+	for _, t := range list {
+		if t.Key == "" {
+			return nil, fmt.Errorf("%s: tag with an empty Key", path)
+		}
+		tags = append(tags, types.Tag{Key: aws.String(t.Key), Value: aws.String(t.Value)})
+	}
+	return tags, nil
+}
+
+// tagsFromMap converts Key: Value pairs into tags, sorted by key so the
+// result does not depend on map order.
+func tagsFromMap(pairs map[string]string) []types.Tag {
+	keys := make([]string, 0, len(pairs))
+	for key := range pairs {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	tags := make([]types.Tag, 0, len(keys))
+	for _, key := range keys {
+		tags = append(tags, types.Tag{Key: aws.String(key), Value: aws.String(pairs[key])})
+	}
+	return tags
+}
+
+// mergeTags returns base with overrides applied: a tag in overrides replaces
+// the tag with the same key in base, and new keys are appended.
+func mergeTags(base, overrides []types.Tag) []types.Tag {
+	merged := slices.Clone(base)
+	for _, tag := range overrides {
+		i := slices.IndexFunc(merged, func(t types.Tag) bool {
+			return aws.ToString(t.Key) == aws.ToString(tag.Key)
+		})
+		if i >= 0 {
+			merged[i] = tag
+		} else {
+			merged = append(merged, tag)
+		}
+	}
+	return merged
+}
+
+// copyPrefixListTags copies the tags of the lists stored under source to the
+// lists of the same address family stored under target. Tag keys the target
+// already has are skipped unless overwrite is set, and the reserved aws:
+// tags are never copied.
+func copyPrefixListTags(svc *ec2.Client, source, target string, overwrite bool) error {
+	sources, err := resolvePrefixLists(svc, source, "")
+	if err != nil {
+		return err
+	}
+	targets, err := resolvePrefixLists(svc, target, "")
+	if err != nil {
+		return err
+	}
+
+	for _, dst := range targets {
+		i := slices.IndexFunc(sources, func(src types.ManagedPrefixList) bool {
+			return aws.ToString(src.AddressFamily) == aws.ToString(dst.AddressFamily)
+		})
+		if i < 0 {
+			log.Printf("No %s source list for %s, skipping", aws.ToString(dst.AddressFamily), aws.ToString(dst.PrefixListName))
+			continue
+		}
+
+		var tags []types.Tag
+		for _, tag := range sources[i].Tags {
+			key := aws.ToString(tag.Key)
+			if strings.HasPrefix(key, "aws:") {
+				continue
+			}
+			existing := slices.IndexFunc(dst.Tags, func(t types.Tag) bool { return aws.ToString(t.Key) == key })
+			if existing >= 0 && !overwrite {
+				log.Printf("%s already has tag %s, skipping", aws.ToString(dst.PrefixListName), key)
+				continue
+			}
+			tags = append(tags, tag)
+		}
+		if len(tags) == 0 {
+			continue
+		}
+
+		createTagsInput := &ec2.CreateTagsInput{
+			Resources: []string{aws.ToString(dst.PrefixListId)},
+			Tags:      tags,
+		}
+		if _, err := svc.CreateTags(context.TODO(), createTagsInput); err != nil {
+			return fmt.Errorf("failed to tag %s: %w", aws.ToString(dst.PrefixListName), err)
+		}
+		if !jsonOutput() {
+			fmt.Printf("Copied %d tag(s) from %s to %s\n", len(tags), aws.ToString(sources[i].PrefixListName), aws.ToString(dst.PrefixListName))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// webhookText summarizes an operation in one line, e.g. "Updated prefix
+// list mylist-ipv4: +15 entries, -3 entries, version 42".
+func webhookText(record operationRecord) string {
+	verbs := map[string][2]string{
+		"create": {"Created", "create"},
+		"update": {"Updated", "update"},
+		"delete": {"Deleted", "delete"},
+	}
+	verb, ok := verbs[record.Action]
+	if !ok {
+		verb = [2]string{record.Action, record.Action}
+	}
+	if !record.Success {
+		return fmt.Sprintf("Failed to %s prefix list %s: %s", verb[1], record.PrefixListName, record.Error)
+	}
+	text := fmt.Sprintf("%s prefix list %s: +%d entries, -%d entries", verb[0], record.PrefixListName, record.EntriesAdded, record.EntriesRemoved)
+	if record.Version > 0 {
+		text += fmt.Sprintf(", version %d", record.Version)
+	}
+	return text
+}
+
+// webhookPayload builds the body to POST for -webhook-format: a plain
+// {"text": ...} object, a Slack message with a colored attachment, or a
+// Teams message carrying an Adaptive Card.
+func webhookPayload(record operationRecord) any {
+	text := webhookText(record)
+	facts := [][2]string{
+		{"Prefix list", record.PrefixListName + " (" + record.PrefixListID + ")"},
+		{"Added", strconv.Itoa(record.EntriesAdded)},
+		{"Removed", strconv.Itoa(record.EntriesRemoved)},
+	}
+	switch opts.webhookFormat {
+	case "slack":
+		color := "good"
+		if !record.Success {
+			color = "danger"
+		}
+		var fields []map[string]any
+		for _, f := range facts {
+			fields = append(fields, map[string]any{"title": f[0], "value": f[1], "short": true})
+		}
+		return map[string]any{
+			"attachments": []map[string]any{{
+				"color":    color,
+				"fallback": text,
+				"text":     text,
+				"fields":   fields,
+			}},
+		}
+	case "teams":
+		var factSet []map[string]string
+		for _, f := range facts {
+			factSet = append(factSet, map[string]string{"title": f[0], "value": f[1]})
+		}
+		return map[string]any{
+			"type": "message",
+			"attachments": []map[string]any{{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content": map[string]any{
+					"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+					"type":    "AdaptiveCard",
+					"version": "1.4",
+					"body": []map[string]any{
+						{"type": "TextBlock", "text": text, "wrap": true},
+						{"type": "FactSet", "facts": factSet},
+					},
+				},
+			}},
+		}
+	default:
+		return map[string]string{"text": text}
+	}
+}
+
+// postWebhook POSTs the outcome of an operation to -webhook-url. Failures
+// are logged, as the operation itself is already done. The URL of a Slack or
+// Teams webhook is a secret, so only its host is logged.
+func postWebhook(record operationRecord) {
+	var host string
+	if u, err := url.Parse(opts.webhookURL); err == nil {
+		host = u.Host
+	}
+	body, _ := json.Marshal(webhookPayload(record))
+	resp, err := newHTTPClient().Post(opts.webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// A *url.Error quotes the full URL.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		log.Printf("Warning: failed to post webhook to %s: %v", host, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		log.Printf("Warning: webhook at %s returned %s", host, resp.Status)
+	}
+}